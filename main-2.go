@@ -37,6 +37,14 @@ func (*RootResolver) Greet() string {
 // Define a schema:
 var Schema = graphql.MustParseSchema(schemaString, &RootResolver{})
 
+// We print responses with json.MarshalIndent. Its prefix
+// and indent are set here, so switching to, say, two-space
+// indentation is a one-line change:
+var (
+	IndentPrefix = ""
+	IndentString = "\t"
+)
+
 func main() {
 	query := `{
 		greet
@@ -54,7 +62,7 @@ func main() {
 
 	ctx := context.Background()
 	resp := Schema.Exec(ctx, query, "", nil)
-	json, err := json.MarshalIndent(resp, "", "\t")
+	json, err := json.MarshalIndent(resp, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
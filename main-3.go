@@ -14,12 +14,20 @@ const schemaString = `
 		query: Query
 	}
 	type Query {
-		# Generic greeting, e.g. "Hello, world!":
-		greet: String!
+		# Generic greeting, e.g. "Hello, world!" or "Olá Mundo!":
+		greet(locale: Locale = EN): String!
 		# Customized greeting, e.g. "Hello, Johan!":
 		greetPerson(person: String!): String!
 		# More customized greeting, e.g. "Good morning, Johan!":
 		greetPersonTimeOfDay(person: String!, timeOfDay: TimeOfDay!): String!
+		# One greeting per time of day, in order:
+		greetMany(person: String!, timesOfDay: [TimeOfDay!]!): [String!]!
+	}
+	# Enumerate supported locales:
+	enum Locale {
+		EN
+		PT
+		UK
 	}
 	# Enumerate times of day:
 	enum TimeOfDay {
@@ -31,8 +39,15 @@ const schemaString = `
 
 type RootResolver struct{}
 
-func (*RootResolver) Greet() string {
-	return "Hello, world!"
+var Greetings = map[string]string{
+	"EN": "Hello, world!",
+	"PT": "Olá Mundo!",
+	"UK": "Привіт Світ!",
+}
+
+// locale defaults to EN in the schema, so it’s always set:
+func (*RootResolver) Greet(args struct{ Locale string }) string {
+	return Greetings[args.Locale]
 }
 
 func (*RootResolver) GreetPerson(args struct{ Person string }) string {
@@ -61,8 +76,29 @@ func (*RootResolver) GreetPersonTimeOfDay(ctx context.Context, args PersonTimeOf
 	return fmt.Sprintf("%s, %s!", timeOfDay, args.Person)
 }
 
+// List arguments are slices; a list of enums is a []string:
+type PersonTimesOfDayArgs struct {
+	Person     string
+	TimesOfDay []string
+}
+
+func (r *RootResolver) GreetMany(ctx context.Context, args PersonTimesOfDayArgs) []string {
+	greetings := []string{}
+	for _, timeOfDay := range args.TimesOfDay {
+		greeting := r.GreetPersonTimeOfDay(ctx, PersonTimeOfDayArgs{args.Person, timeOfDay})
+		greetings = append(greetings, greeting)
+	}
+	return greetings
+}
+
 var Schema = graphql.MustParseSchema(schemaString, &RootResolver{})
 
+// Indentation for printed JSON (see main-2):
+var (
+	IndentPrefix = ""
+	IndentString = "\t"
+)
+
 func main() {
 	ctx := context.Background()
 
@@ -81,7 +117,7 @@ func main() {
 		Variables: nil,
 	}
 	resp1 := Schema.Exec(ctx, q1.Query, q1.OpName, q1.Variables)
-	json1, err := json.MarshalIndent(resp1, "", "\t")
+	json1, err := json.MarshalIndent(resp1, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -106,7 +142,7 @@ func main() {
 	}
 
 	resp2 := Schema.Exec(ctx, q2.Query, q2.OpName, q2.Variables)
-	json2, err := json.MarshalIndent(resp2, "", "\t")
+	json2, err := json.MarshalIndent(resp2, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -130,7 +166,7 @@ func main() {
 		},
 	}
 	resp3 := Schema.Exec(ctx, q3.Query, q3.OpName, q3.Variables)
-	json3, err := json.MarshalIndent(resp3, "", "\t")
+	json3, err := json.MarshalIndent(resp3, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -142,4 +178,53 @@ func main() {
 	// 		"greetPersonTimeOfDay": "Good morning, Johan!"
 	// 	}
 	// }
+
+	q4 := ClientQuery{
+		OpName: "GreetLocale",
+		// Enums can also be inlined:
+		Query: `query GreetLocale {
+			greet(locale: PT)
+		}`,
+		Variables: nil,
+	}
+	resp4 := Schema.Exec(ctx, q4.Query, q4.OpName, q4.Variables)
+	json4, err := json.MarshalIndent(resp4, IndentPrefix, IndentString)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(json4))
+	// Expected output:
+	//
+	// {
+	// 	"data": {
+	// 		"greet": "Olá Mundo!"
+	// 	}
+	// }
+
+	q5 := ClientQuery{
+		OpName: "GreetMany",
+		// Lists are written with brackets:
+		Query: `query GreetMany($person: String!) {
+			greetMany(person: $person, timesOfDay: [MORNING, EVENING])
+		}`,
+		Variables: map[string]interface{}{
+			"person": "Johan",
+		},
+	}
+	resp5 := Schema.Exec(ctx, q5.Query, q5.OpName, q5.Variables)
+	json5, err := json.MarshalIndent(resp5, IndentPrefix, IndentString)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(json5))
+	// Expected output:
+	//
+	// {
+	// 	"data": {
+	// 		"greetMany": [
+	// 			"Good morning, Johan!",
+	// 			"Good evening, Johan!"
+	// 		]
+	// 	}
+	// }
 }
@@ -16,26 +16,26 @@ const schemaString = `
 	schema {
 		query: Query
 	}
-	# Define users:
+	"""Define users:"""
 	type User {
 		userID: ID!
 		username: String!
 		emoji: String!
 		notes: [Note!]!
 	}
-	# Define notes:
+	"""Define notes:"""
 	type Note {
 		noteID: ID!
 		data: String!
 	}
 	type Query {
-		# List users:
+		"""List users:"""
 		users: [User!]!
-		# Get user:
+		"""Get user:"""
 		user(userID: ID!): User!
-		# List notes:
+		"""List notes:"""
 		notes(userID: ID!): [Note!]!
-		# Get note:
+		"""Get note:"""
 		note(noteID: ID!): Note!
 	}
 `
@@ -129,11 +129,21 @@ func (r *RootResolver) Note(args struct{ NoteID graphql.ID }) (Note, error) {
 
 var (
 	// We can pass an option to the schema so we don’t need to
-	// write a method to access each type’s field:
-	opts   = []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	// write a method to access each type’s field, and another
+	// so """ strings (rather than # comments) are descriptions:
+	opts = []graphql.SchemaOpt{
+		graphql.UseFieldResolvers(),
+		graphql.UseStringDescriptions(),
+	}
 	Schema = graphql.MustParseSchema(schemaString, &RootResolver{}, opts...)
 )
 
+// Indentation for printed JSON (see main-2):
+var (
+	IndentPrefix = ""
+	IndentString = "\t"
+)
+
 func main() {
 	ctx := context.Background()
 
@@ -155,7 +165,7 @@ func main() {
 		Variables: nil,
 	}
 	resp1 := Schema.Exec(ctx, q1.Query, q1.OpName, q1.Variables)
-	json1, err := json.MarshalIndent(resp1, "", "\t")
+	json1, err := json.MarshalIndent(resp1, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -198,7 +208,7 @@ func main() {
 		},
 	}
 	resp2 := Schema.Exec(ctx, q2.Query, q2.OpName, q2.Variables)
-	json2, err := json.MarshalIndent(resp2, "", "\t")
+	json2, err := json.MarshalIndent(resp2, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -228,7 +238,7 @@ func main() {
 		},
 	}
 	resp3 := Schema.Exec(ctx, q3.Query, q3.OpName, q3.Variables)
-	json3, err := json.MarshalIndent(resp3, "", "\t")
+	json3, err := json.MarshalIndent(resp3, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -267,7 +277,7 @@ func main() {
 		},
 	}
 	resp4 := Schema.Exec(ctx, q4.Query, q4.OpName, q4.Variables)
-	json4, err := json.MarshalIndent(resp4, "", "\t")
+	json4, err := json.MarshalIndent(resp4, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 
@@ -11,7 +12,10 @@ import (
 
 // In the previous example, we used:
 //
-//  opts   = []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+//  opts = []graphql.SchemaOpt{
+//  	graphql.UseFieldResolvers(),
+//  	graphql.UseStringDescriptions(),
+//  }
 //  Schema = graphql.MustParseSchema(schemaString, &RootResolver{}, opts...)
 //
 // This time we won’t use graphql.UseFieldResolvers.
@@ -207,6 +211,31 @@ func (r *NoteResolver) Data() string {
  * main
  */
 
+// Indentation for printed JSON (see main-2):
+var (
+	IndentPrefix = ""
+	IndentString = "\t"
+)
+
+// DecodeData gives clients typed access to a response.
+// resp.Data is raw JSON, so we unmarshal it into a T; if the
+// response has errors, we join them into one:
+func DecodeData[T any](resp *graphql.Response) (T, error) {
+	var data T
+	if len(resp.Errors) > 0 {
+		errs := make([]error, 0, len(resp.Errors))
+		for _, err := range resp.Errors {
+			errs = append(errs, err)
+		}
+		return data, errors.Join(errs...)
+	}
+	err := json.Unmarshal(resp.Data, &data)
+	if err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
 func main() {
 	ctx := context.Background()
 
@@ -216,7 +245,7 @@ func main() {
 		panic(err)
 	}
 	schemaString := string(bstr)
-	schema, err := graphql.ParseSchema(schemaString, &RootResolver{})
+	schema, err := graphql.ParseSchema(schemaString, &RootResolver{}, graphql.UseStringDescriptions())
 	if err != nil {
 		panic(err)
 	}
@@ -245,7 +274,7 @@ func main() {
 		Variables: nil,
 	}
 	resp1 := schema.Exec(ctx, q1.Query, q1.OpName, q1.Variables)
-	json1, err := json.MarshalIndent(resp1, "", "\t")
+	json1, err := json.MarshalIndent(resp1, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -274,6 +303,22 @@ func main() {
 	// 	}
 	// }
 
+	// Instead of printing JSON, we can decode the same
+	// response into Go types. json.Unmarshal matches keys
+	// case-insensitively, so "userID" fills User.UserID:
+	data1, err := DecodeData[struct{ Users []User }](resp1)
+	if err != nil {
+		panic(err)
+	}
+	for _, user := range data1.Users {
+		fmt.Println(user.UserID, user.Username, user.Emoji)
+	}
+	// Expected output:
+	//
+	// u-001 nyxerys 🇵🇹
+	// u-002 rdnkta 🇺🇦
+	// u-003 username_ZAYDEK 🇺🇸
+
 	q2 := ClientQuery{
 		OpName: "Users",
 		Query: `query Users($userID: ID!) {
@@ -288,7 +333,7 @@ func main() {
 		},
 	}
 	resp2 := schema.Exec(ctx, q2.Query, q2.OpName, q2.Variables)
-	json2, err := json.MarshalIndent(resp2, "", "\t")
+	json2, err := json.MarshalIndent(resp2, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -318,7 +363,7 @@ func main() {
 		},
 	}
 	resp3 := schema.Exec(ctx, q3.Query, q3.OpName, q3.Variables)
-	json3, err := json.MarshalIndent(resp3, "", "\t")
+	json3, err := json.MarshalIndent(resp3, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -357,7 +402,7 @@ func main() {
 		},
 	}
 	resp4 := schema.Exec(ctx, q4.Query, q4.OpName, q4.Variables)
-	json4, err := json.MarshalIndent(resp4, "", "\t")
+	json4, err := json.MarshalIndent(resp4, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -389,7 +434,7 @@ func main() {
 		},
 	}
 	resp5 := schema.Exec(ctx, q5.Query, q5.OpName, q5.Variables)
-	json5, err := json.MarshalIndent(resp5, "", "\t")
+	json5, err := json.MarshalIndent(resp5, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -421,7 +466,7 @@ func main() {
 		Variables: nil,
 	}
 	resp6 := schema.Exec(ctx, q6.Query, q6.OpName, q6.Variables)
-	json6, err := json.MarshalIndent(resp6, "", "\t")
+	json6, err := json.MarshalIndent(resp6, IndentPrefix, IndentString)
 	if err != nil {
 		panic(err)
 	}
@@ -447,4 +492,55 @@ func main() {
 	// 		]
 	// 	}
 	// }
+
+	// @include and @skip are built into GraphQL: the server
+	// omits fields based on a variable, so one query can serve
+	// different views. Here emoji is included only with
+	// $withEmoji and userID is skipped with it:
+	q7 := ClientQuery{
+		OpName: "UsersWithEmoji",
+		Query: `query UsersWithEmoji($withEmoji: Boolean!) {
+			users {
+				userID @skip(if: $withEmoji)
+				username
+				emoji @include(if: $withEmoji)
+			}
+		}`,
+		Variables: JSON{
+			"withEmoji": false,
+		},
+	}
+	resp7 := schema.Exec(ctx, q7.Query, q7.OpName, q7.Variables)
+	json7, err := json.MarshalIndent(resp7, IndentPrefix, IndentString)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(json7))
+	// Expected output:
+	//
+	// {
+	// 	"data": {
+	// 		"users": [
+	// 			{
+	// 				"userID": "u-001",
+	// 				"username": "nyxerys"
+	// 			},
+	// 			// ...
+	// 		]
+	// 	}
+	// }
+	//
+	// With "withEmoji": true:
+	//
+	// {
+	// 	"data": {
+	// 		"users": [
+	// 			{
+	// 				"username": "nyxerys",
+	// 				"emoji": "🇵🇹"
+	// 			},
+	// 			// ...
+	// 		]
+	// 	}
+	// }
 }
@@ -15,20 +15,99 @@ create extension pgcrypto;
 --
 -- check (username ~ '^\w{3,8}$') checks that a username is
 -- 3-8 alphanumeric characters.
+--
+-- 3:
+--
+-- check (status in (...)) mirrors the NoteStatus enum in
+-- main-6-schema.graphql; notes are published by default.
+--
+-- 4:
+--
+-- position serial gives each new note the next position, so
+-- notes are ordered by creation until they’re reordered (see
+-- reorderNotes).
+--
+-- 5:
+--
+-- on delete cascade deletes a user’s notes along with the
+-- user, so there are never orphaned notes.
+--
+-- 6:
+--
+-- The notes_updated_at trigger bumps updated_at and version
+-- whenever a note changes, however it changes, so no UPDATE
+-- can forget to (see updateNoteIfVersion).
 
 create table users (
-  user_id  text not null unique default 'u-' || substr(gen_random_uuid()::text, 1, 6),
-  username text not null unique check (username ~ '^\w{3,8}$') );
+  user_id    text not null unique default 'u-' || substr(gen_random_uuid()::text, 1, 6),
+  username   text not null unique check (username ~ '^\w{3,8}$'),
+  emoji      text not null,
+  created_at timestamptz not null default now() );
 
 create table notes (
-  user_id  text not null references users (user_id),
-  note_id  text not null unique default 'n-' || substr(gen_random_uuid()::text, 1, 6),
-  data     text not null );
+  user_id     text not null references users (user_id) on delete cascade,
+  note_id     text not null unique default 'n-' || substr(gen_random_uuid()::text, 1, 6),
+  data        text not null,
+  status      text not null default 'PUBLISHED' check (status in ('DRAFT', 'PUBLISHED', 'ARCHIVED')),
+  position    serial,
+  version     integer not null default 1,
+  pinned      boolean not null default false,
+  created_at  timestamptz not null default now(),
+  updated_at  timestamptz not null default now(),
+  archived_at timestamptz );
+
+create function set_updated_at() returns trigger as $$
+begin
+  new.updated_at = now();
+  new.version = old.version + 1;
+  return new;
+end;
+$$ language plpgsql;
+
+create trigger notes_updated_at before update on notes
+  for each row execute procedure set_updated_at();
+
+-- archived_at is when the note was archived, for pruning. Any
+-- update moves updated_at, but only a change of status moves
+-- archived_at:
+create function set_archived_at() returns trigger as $$
+begin
+  if new.status <> 'ARCHIVED' then
+    new.archived_at = null;
+  elsif tg_op = 'INSERT' or old.status <> 'ARCHIVED' then
+    new.archived_at = now();
+  end if;
+  return new;
+end;
+$$ language plpgsql;
+
+create trigger notes_archived_at before insert or update on notes
+  for each row execute procedure set_archived_at();
+
+-- Usernames are unique regardless of case, so "Zaydek" can’t
+-- sign up alongside "zaydek":
+create unique index users_username_lower on users (lower(username));
+
+-- Tags are stored lowercase, so "Work" and "work" are the
+-- same tag:
+create table note_tags (
+  note_id text not null references notes (note_id) on delete cascade,
+  tag     text not null check (tag = lower(tag)),
+  primary key (note_id, tag) );
+
+-- Responses to mutations sent with an Idempotency-Key header,
+-- replayed when a client retries with the same key:
+create table idempotency_keys (
+  key          text not null primary key,
+  caller       text not null,
+  request_hash text not null,
+  response     text,
+  created_at   timestamptz not null default now() );
 
 -- Insert mock data:
-insert into users (username) values ('nyxerys');
-insert into users (username) values ('rdnkta');
-insert into users (username) values ('zaydek');
+insert into users (username, emoji) values ('nyxerys', '🇵🇹');
+insert into users (username, emoji) values ('rdnkta', '🇺🇦');
+insert into users (username, emoji) values ('zaydek', '🇺🇸');
 
 insert into notes (user_id, data) values ((select user_id from users where username = 'nyxerys'), 'Olá Mundo!');
 insert into notes (user_id, data) values ((select user_id from users where username = 'nyxerys'), 'Olá novamente, mundo!');
@@ -39,3 +118,7 @@ insert into notes (user_id, data) values ((select user_id from users where usern
 insert into notes (user_id, data) values ((select user_id from users where username = 'zaydek' ), 'Hello, world!');
 insert into notes (user_id, data) values ((select user_id from users where username = 'zaydek' ), 'Hello again, world!');
 insert into notes (user_id, data) values ((select user_id from users where username = 'zaydek' ), 'Hello, darkness!');
+
+insert into note_tags (note_id, tag) select note_id, 'world'    from notes where data ~* 'mundo|світ|world';
+insert into note_tags (note_id, tag) select note_id, 'again'    from notes where data ~* 'novamente|ще раз|again';
+insert into note_tags (note_id, tag) select note_id, 'darkness' from notes where data ~* 'escuridão|темрява|darkness';
@@ -1,14 +1,44 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	graphql "github.com/graph-gophers/graphql-go"
-	_ "github.com/lib/pq"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"github.com/graph-gophers/graphql-go/types"
+	"github.com/lib/pq"
+	"golang.org/x/sync/errgroup"
 )
 
 // This version uses a Postgres database with mock data.
@@ -52,37 +82,115 @@ import (
 type User struct {
 	UserID   graphql.ID
 	Username string
+	Emoji    string
 	Notes    []*Note
 }
 
 type Note struct {
-	NoteID graphql.ID
-	Data   string
+	NoteID    graphql.ID
+	Data      string
+	Status    string
+	UpdatedAt time.Time
+	Version   int32
 }
 
 type NoteInput struct{ Data string }
 
+// DateTime implements the DateTime scalar: an RFC 3339
+// timestamp in UTC, e.g. "2019-08-01T12:00:00Z". Fractional
+// seconds are kept both ways, so a timestamp read from Postgres
+// (which stores microseconds) round-trips exactly, e.g. as a
+// notesModifiedSince cursor.
+//
+// graphql-go needs no registration beyond the schema’s
+// `scalar DateTime`: an argument or input field typed DateTime
+// (or *DateTime when nullable) is decoded by UnmarshalGraphQL,
+// which must have a pointer receiver. Literals and variables
+// take the same path, so a variable is just the string, e.g.
+// {"since": "2019-08-01T12:00:00Z"}, and a bad one fails the
+// request with UnmarshalGraphQL’s error before any resolver
+// runs.
+type DateTime struct{ time.Time }
+
+func (DateTime) ImplementsGraphQLType(name string) bool {
+	return name == "DateTime"
+}
+
+func (t *DateTime) UnmarshalGraphQL(input interface{}) error {
+	str, ok := input.(string)
+	if !ok {
+		return fmt.Errorf("DateTime: expected a string, got %T", input)
+	}
+	parsed, err := time.Parse(time.RFC3339, str)
+	if err != nil {
+		return fmt.Errorf("DateTime: %w", err)
+	}
+	t.Time = parsed
+	return nil
+}
+
+func (t DateTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.UTC().Format(time.RFC3339Nano))
+}
+
 /*
  * RootResolver
+ *
+ * The root is composed of resolvers for queries, mutations,
+ * and subscriptions. graphql-go binds root fields to methods
+ * by name, and Go promotes the methods of embedded structs,
+ * so RootResolver has the methods of both. Larger APIs can
+ * split each side further the same way, as long as no two
+ * embedded resolvers define the same method.
  */
 
-type RootResolver struct{}
+type RootResolver struct {
+	QueryResolver
+	MutationResolver
+	SubscriptionResolver
+}
+
+type QueryResolver struct{}
 
-func (r *RootResolver) Users() ([]*UserResolver, error) {
+// Users lazy-loads notes by default: UserResolver.Notes
+// queries each user’s notes separately, so n users cost n+1
+// queries. With includeNotes, we eagerly load users and
+// notes in one joined query and assemble them in Go instead.
+//
+// Users and Notes stop scanning rows as soon as the request
+// is cancelled or times out: QueryContext cancels the query
+// itself, and checking ctx between rows stops us scanning
+// rows the driver already buffered.
+func (r *QueryResolver) Users(ctx context.Context, args struct{ IncludeNotes bool }) ([]*UserResolver, error) {
+	if args.IncludeNotes {
+		return usersWithNotes(ctx)
+	}
 	var userRxs []*UserResolver
-	rows, err := DB.Query(`
-		SELECT
-			user_id,
-			username
-		FROM users
-	`)
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.users", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				user_id,
+				username,
+				emoji
+			FROM users
+			ORDER BY user_id
+			LIMIT $1
+		`, MaxResults+1)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
 		user := &User{}
-		err := rows.Scan(&user.UserID, &user.Username)
+		err := rows.Scan(&user.UserID, &user.Username, &user.Emoji)
 		if err != nil {
 			return nil, err
 		}
@@ -92,136 +200,5403 @@ func (r *RootResolver) Users() ([]*UserResolver, error) {
 	if err != nil {
 		return nil, err
 	}
-	return userRxs, nil
+	return userRxs[:capResults(ctx, "users", len(userRxs))], nil
+}
+
+// usersWithNotes left joins users to notes, so users without
+// notes still appear, once, with null note columns. Rows are
+// ordered by user so we can append notes to the last user.
+func usersWithNotes(ctx context.Context) ([]*UserResolver, error) {
+	var userRxs []*UserResolver
+	var rows *sql.Rows
+	err := timeQuery(ctx, "usersWithNotes", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				users.user_id,
+				users.username,
+				users.emoji,
+				notes.note_id,
+				notes.data,
+				notes.status,
+				notes.updated_at,
+				notes.version
+			FROM (
+				SELECT *
+				FROM users
+				ORDER BY user_id
+				LIMIT $1
+			) users
+			LEFT JOIN LATERAL (
+				SELECT *
+				FROM notes
+				WHERE notes.user_id = users.user_id
+				ORDER BY pinned DESC, position
+				LIMIT $1
+			) notes ON true
+			ORDER BY users.user_id, notes.pinned DESC, notes.position
+		`, MaxResults+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var user *User
+	for rows.Next() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		var (
+			u                    User
+			noteID, data, status sql.NullString
+			updatedAt            sql.NullTime
+			version              sql.NullInt32
+		)
+		err := rows.Scan(&u.UserID, &u.Username, &u.Emoji, &noteID, &data, &status, &updatedAt, &version)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil || user.UserID != u.UserID {
+			user = &u
+			// Non-nil, so UserResolver.Notes knows the notes
+			// were loaded even when there are none:
+			user.Notes = []*Note{}
+			userRxs = append(userRxs, &UserResolver{user})
+		}
+		if noteID.Valid {
+			note := &Note{NoteID: graphql.ID(noteID.String), Data: data.String, Status: status.String, UpdatedAt: updatedAt.Time, Version: version.Int32}
+			user.Notes = append(user.Notes, note)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	for _, userRx := range userRxs {
+		userRx.u.Notes = userRx.u.Notes[:capResults(ctx, "notes", len(userRx.u.Notes))]
+	}
+	return userRxs[:capResults(ctx, "users", len(userRxs))], nil
+}
+
+func (r *QueryResolver) User(ctx context.Context, args struct{ UserID graphql.ID }) (*UserResolver, error) {
+	user := &User{}
+	err := timeQuery(ctx, "Query.user", func() error {
+		return ReadDB().QueryRowContext(ctx, `
+			SELECT
+				user_id,
+				username,
+				emoji
+			FROM users
+			WHERE user_id = $1
+		`, args.UserID).Scan(&user.UserID, &user.Username, &user.Emoji)
+	})
+	if err == sql.ErrNoRows {
+		return nil, localizedError(ctx, CodeUserNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	return &UserResolver{user}, nil
+}
+
+// DefaultNotesLimit is how many notes notes returns when the
+// client omits limit:
+const DefaultNotesLimit = 10
+
+type NotesArgs struct {
+	UserID graphql.ID
+	Limit  *int32
+}
+
+func (r *QueryResolver) Notes(ctx context.Context, args NotesArgs) ([]*NoteResolver, error) {
+	if args.Limit != nil && *args.Limit < 0 {
+		return nil, &ValidationError{Field: "limit", Message: "must not be negative"}
+	}
+	limit := clampResults(ctx, "limit", args.Limit, DefaultNotesLimit, MaxResults)
+	return memoNotes(ctx, args.UserID, &limit)
+}
+
+// Queryer is satisfied by both *sql.DB and *sql.Tx, so reads
+// can also run inside a transaction:
+type Queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// nonNilNotes turns a nil slice into an empty one so list
+// resolvers always answer [] rather than nothing at all. graphql-go
+// already renders a nil slice as [] for [Note!]!, but a resolver
+// shouldn’t rely on that:
+func nonNilNotes(noteRxs []*NoteResolver) []*NoteResolver {
+	if noteRxs == nil {
+		return []*NoteResolver{}
+	}
+	return noteRxs
+}
+
+// queryNotes returns up to limit notes, pinned notes first, or
+// up to MaxResults of them when limit is nil:
+func queryNotes(ctx context.Context, q Queryer, userID graphql.ID, limit *int32) ([]*NoteResolver, error) {
+	// Without a limit, we fetch one more than MaxResults to
+	// tell whether there were more:
+	queryLimit := MaxResults + 1
+	if limit != nil {
+		queryLimit = *limit
+	}
+	var noteRxs []*NoteResolver
+	var rows *sql.Rows
+	err := timeQuery(ctx, "queryNotes", func() (err error) {
+		rows, err = q.QueryContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			WHERE user_id = $1
+			ORDER BY pinned DESC, position
+			LIMIT $2
+		`, userID, queryLimit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		note := &Note{}
+		err := rows.Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != nil {
+			return nil, err
+		}
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	if limit == nil {
+		noteRxs = noteRxs[:capResults(ctx, "notes", len(noteRxs))]
+	}
+	primeTags(ctx, noteRxs...)
+	return nonNilNotes(noteRxs), nil
+}
+
+func (r *QueryResolver) Note(ctx context.Context, args struct{ NoteID graphql.ID }) (*NoteResolver, error) {
+	note := &Note{}
+	err := timeQuery(ctx, "Query.note", func() error {
+		return ReadDB().QueryRowContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			WHERE note_id = $1
+		`, args.NoteID).Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+	})
+	if err == sql.ErrNoRows {
+		return nil, localizedError(ctx, CodeNoteNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	return &NoteResolver{note}, nil
+}
+
+// Fields left null aren’t filtered on:
+type NoteFilter struct {
+	UserID       *graphql.ID
+	Status       *string
+	ContainsText *string
+	CreatedAfter *DateTime
+}
+
+// whereBuilder builds a WHERE clause one condition at a
+// time. Each condition has a single %d, which becomes its
+// argument’s $N placeholder, so values never end up in the
+// SQL itself.
+type whereBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+func (b *whereBuilder) add(cond string, arg interface{}) {
+	b.args = append(b.args, arg)
+	b.conds = append(b.conds, fmt.Sprintf(cond, len(b.args)))
+}
+
+func (b *whereBuilder) String() string {
+	return "WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// where builds the WHERE clause for the filter. At least one
+// field must be set, so a filter can’t return every note.
+func (f NoteFilter) where() (*whereBuilder, error) {
+	b := &whereBuilder{}
+	if f.UserID != nil {
+		b.add("user_id = $%d", *f.UserID)
+	}
+	if f.Status != nil {
+		b.add("status = $%d", *f.Status)
+	}
+	if f.ContainsText != nil {
+		b.add("strpos(lower(data), lower($%d)) > 0", *f.ContainsText)
+	}
+	if f.CreatedAfter != nil {
+		b.add("created_at > $%d", f.CreatedAfter.Time)
+	}
+	if len(b.conds) == 0 {
+		return nil, &ValidationError{Field: "filter", Message: "must set at least one field"}
+	}
+	return b, nil
+}
+
+// FilterNotes has no limit argument, so it returns at most
+// MaxResults notes (see capResults):
+func (r *QueryResolver) FilterNotes(ctx context.Context, args struct{ Filter NoteFilter }) ([]*NoteResolver, error) {
+	where, err := args.Filter.where()
+	if err != nil {
+		return nil, err
+	}
+	var noteRxs []*NoteResolver
+	var rows *sql.Rows
+	err = timeQuery(ctx, "Query.filterNotes", func() (err error) {
+		rows, err = DB.QueryContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			`+where.String()+`
+			ORDER BY created_at, note_id
+			LIMIT `+fmt.Sprint(MaxResults+1)+`
+		`, where.args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		note := &Note{}
+		err := rows.Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != nil {
+			return nil, err
+		}
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	noteRxs = noteRxs[:capResults(ctx, "filterNotes", len(noteRxs))]
+	primeTags(ctx, noteRxs...)
+	return nonNilNotes(noteRxs), nil
+}
+
+// CountNotes counts the notes filterNotes matches, using the
+// same WHERE clause, so clients can show a count before
+// paging. Unlike filterNotes, it isn’t capped at MaxResults.
+func (r *QueryResolver) CountNotes(ctx context.Context, args struct{ Filter NoteFilter }) (int32, error) {
+	where, err := args.Filter.where()
+	if err != nil {
+		return 0, err
+	}
+	var count int32
+	err = timeQuery(ctx, "Query.countNotes", func() error {
+		return DB.QueryRowContext(ctx, `
+			SELECT count(*)
+			FROM notes
+			`+where.String()+`
+		`, where.args...).Scan(&count)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// UsernameAvailable lets signup forms check a username as it’s
+// typed. Like the unique index on lower(username), it ignores
+// case.
+func (r *QueryResolver) UsernameAvailable(ctx context.Context, args struct{ Username string }) (bool, error) {
+	var taken bool
+	err := timeQuery(ctx, "Query.usernameAvailable", func() error {
+		return ReadDB().QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1
+				FROM users
+				WHERE lower(username) = lower($1)
+			)
+		`, args.Username).Scan(&taken)
+	})
+	if err != nil {
+		return false, err
+	}
+	return !taken, nil
+}
+
+// Countries returns each flag emoji once, sorted. It’s never
+// null: no users means an empty list.
+func (r *QueryResolver) Countries(ctx context.Context) ([]string, error) {
+	countries := []string{}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.countries", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT DISTINCT emoji
+			FROM users
+			ORDER BY emoji
+		`)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var emoji string
+		err := rows.Scan(&emoji)
+		if err != nil {
+			return nil, err
+		}
+		countries = append(countries, emoji)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return countries, nil
+}
+
+// NotesByCountry counts notes per flag. The LEFT JOIN keeps
+// countries whose users haven’t written anything, and count(n.*)
+// skips the all-null row the join makes for them, so they come
+// back as 0:
+func (r *QueryResolver) NotesByCountry(ctx context.Context) ([]*CountryCountResolver, error) {
+	countRxs := []*CountryCountResolver{}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.notesByCountry", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				u.emoji,
+				count(n.*)
+			FROM users u
+			LEFT JOIN notes n ON n.user_id = u.user_id
+			GROUP BY u.emoji
+			ORDER BY u.emoji
+		`)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		countRx := &CountryCountResolver{}
+		err := rows.Scan(&countRx.emoji, &countRx.count)
+		if err != nil {
+			return nil, err
+		}
+		countRxs = append(countRxs, countRx)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return countRxs, nil
+}
+
+// TodaysNotes returns the notes a user wrote today, where a
+// day starts at midnight UTC rather than in the server’s
+// timezone, so the answer doesn’t depend on where Postgres
+// runs:
+func (r *QueryResolver) TodaysNotes(ctx context.Context, args struct{ UserID graphql.ID }) ([]*NoteResolver, error) {
+	noteRxs := []*NoteResolver{}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.todaysNotes", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			WHERE user_id = $1 AND created_at >= date_trunc('day', now(), 'UTC')
+			ORDER BY created_at, note_id
+			LIMIT $2
+		`, args.UserID, MaxResults+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		note := &Note{}
+		err := rows.Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != nil {
+			return nil, err
+		}
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	noteRxs = noteRxs[:capResults(ctx, "todaysNotes", len(noteRxs))]
+	primeTags(ctx, noteRxs...)
+	return noteRxs, nil
+}
+
+// GlobalSearch finds users by username and notes by data,
+// case-insensitively. The results are grouped by type rather
+// than one list of a union, which is simpler for clients. The
+// two searches are independent, so they run concurrently; an
+// errgroup cancels the other search as soon as one fails, as
+// its results would be thrown away. An empty query matches
+// nothing:
+func (r *QueryResolver) GlobalSearch(ctx context.Context, args struct{ Query string }) (*SearchResultsResolver, error) {
+	results := &SearchResultsResolver{users: []*UserResolver{}, notes: []*NoteResolver{}}
+	if strings.TrimSpace(args.Query) == "" {
+		return results, nil
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		results.users, err = searchUsers(gctx, args.Query)
+		return err
+	})
+	g.Go(func() (err error) {
+		results.notes, err = searchNotes(gctx, args.Query)
+		return err
+	})
+	err := g.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func searchUsers(ctx context.Context, text string) ([]*UserResolver, error) {
+	userRxs := []*UserResolver{}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "searchUsers", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				user_id,
+				username,
+				emoji
+			FROM users
+			WHERE strpos(lower(username), lower($1)) > 0
+			ORDER BY username
+			LIMIT $2
+		`, text, MaxResults+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user := &User{}
+		err := rows.Scan(&user.UserID, &user.Username, &user.Emoji)
+		if err != nil {
+			return nil, err
+		}
+		userRxs = append(userRxs, &UserResolver{user})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return userRxs[:capResults(ctx, "search", len(userRxs))], nil
+}
+
+func searchNotes(ctx context.Context, text string) ([]*NoteResolver, error) {
+	noteRxs := []*NoteResolver{}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "searchNotes", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			WHERE strpos(lower(data), lower($1)) > 0
+			ORDER BY created_at, note_id
+			LIMIT $2
+		`, text, MaxResults+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		note := &Note{}
+		err := rows.Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != nil {
+			return nil, err
+		}
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	noteRxs = noteRxs[:capResults(ctx, "search", len(noteRxs))]
+	primeTags(ctx, noteRxs...)
+	return noteRxs, nil
+}
+
+// MaxClockSkew is how far in the future notesModifiedSince
+// accepts since, to allow for clients whose clocks run fast:
+const MaxClockSkew = 5 * time.Minute
+
+type NotesModifiedSinceArgs struct {
+	UserID      graphql.ID
+	Since       DateTime
+	AfterNoteID *graphql.ID
+}
+
+// NotesModifiedSince lets an offline client sync: it sends the
+// updatedAt and noteID of the last note it saw and gets the
+// notes changed since, oldest first. The cursor is the pair,
+// not updatedAt alone: notes updated in one transaction share
+// an updated_at, and a strict `updated_at > since` would skip
+// the ones past a page boundary. Without afterNoteID, notes
+// updated exactly at since are included; a client may see one
+// twice but never misses one. When there are more than
+// MaxResults, the page is truncated with a warning and the
+// client should sync again from its last note. Deleted notes
+// are deleted outright (there’s no deleted_at column), so
+// there are no tombstones to return.
+func (r *QueryResolver) NotesModifiedSince(ctx context.Context, args NotesModifiedSinceArgs) ([]*NoteResolver, error) {
+	if args.Since.After(time.Now().Add(MaxClockSkew)) {
+		return nil, &ValidationError{Field: "since", Message: "must not be in the future"}
+	}
+	// note_id is never empty, so "" sorts before every note:
+	afterNoteID := ""
+	if args.AfterNoteID != nil {
+		afterNoteID = string(*args.AfterNoteID)
+	}
+	noteRxs := []*NoteResolver{}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.notesModifiedSince", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			WHERE user_id = $1 AND (updated_at, note_id) > ($2, $3)
+			ORDER BY updated_at, note_id
+			LIMIT $4
+		`, args.UserID, args.Since.Time, afterNoteID, MaxResults+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		note := &Note{}
+		err := rows.Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != nil {
+			return nil, err
+		}
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	noteRxs = noteRxs[:capResults(ctx, "notesModifiedSince", len(noteRxs))]
+	primeTags(ctx, noteRxs...)
+	return noteRxs, nil
+}
+
+// noteLengthHistogram has DefaultHistogramBuckets buckets
+// unless the client asks for more, up to MaxHistogramBuckets:
+const (
+	DefaultHistogramBuckets = 5
+	MaxHistogramBuckets     = 50
+)
+
+// NoteLengthHistogram buckets every note by its length in
+// characters. width_bucket splits [shortest, longest + 1) into
+// equal-width buckets, numbered from 1; the + 1 puts the
+// longest note in the last bucket rather than an overflow
+// bucket. generate_series lists every bucket so empty ones
+// come back with a count of 0. With no notes there’s no range
+// to split, so the list is empty.
+func (r *QueryResolver) NoteLengthHistogram(ctx context.Context, args struct{ Buckets *int32 }) ([]*HistogramBucketResolver, error) {
+	if args.Buckets != nil && *args.Buckets <= 0 {
+		return nil, &ValidationError{Field: "buckets", Message: "must be positive"}
+	}
+	buckets := clampResults(ctx, "buckets", args.Buckets, DefaultHistogramBuckets, MaxHistogramBuckets)
+	bucketRxs := []*HistogramBucketResolver{}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.noteLengthHistogram", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			WITH bounds AS (
+				SELECT
+					min(length(data)) AS lo,
+					max(length(data)) + 1 AS hi
+				FROM notes
+			), counts AS (
+				SELECT
+					width_bucket(length(data), lo, hi, $1) AS bucket,
+					count(*) AS count
+				FROM notes, bounds
+				GROUP BY bucket
+			)
+			SELECT
+				bounds.lo,
+				bounds.hi,
+				buckets.bucket,
+				coalesce(counts.count, 0)
+			FROM bounds
+			CROSS JOIN generate_series(1, $1) AS buckets (bucket)
+			LEFT JOIN counts ON counts.bucket = buckets.bucket
+			WHERE bounds.lo IS NOT NULL
+			ORDER BY buckets.bucket
+		`, buckets)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var lo, hi, bucket int32
+		bucketRx := &HistogramBucketResolver{}
+		err := rows.Scan(&lo, &hi, &bucket, &bucketRx.count)
+		if err != nil {
+			return nil, err
+		}
+		// Bucket i covers [lo + (i-1)*width, lo + i*width); min
+		// and max are the whole lengths in that range:
+		width := float64(hi-lo) / float64(buckets)
+		bucketRx.min = lo + int32(math.Ceil(float64(bucket-1)*width))
+		bucketRx.max = lo + int32(math.Ceil(float64(bucket)*width)) - 1
+		bucketRxs = append(bucketRxs, bucketRx)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return bucketRxs, nil
+}
+
+// LongestNotes pairs each user with their longest note.
+// DISTINCT ON (user_id) keeps the first row per user, and the
+// ORDER BY makes that row the longest note, the oldest on
+// ties. The LEFT JOIN keeps users without notes; their note
+// is null:
+func (r *QueryResolver) LongestNotes(ctx context.Context) ([]*UserLongestNoteResolver, error) {
+	longestRxs := []*UserLongestNoteResolver{}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.longestNotes", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT DISTINCT ON (users.user_id)
+				users.user_id,
+				users.username,
+				users.emoji,
+				notes.note_id,
+				notes.data,
+				notes.status,
+				notes.updated_at,
+				notes.version
+			FROM users
+			LEFT JOIN notes ON notes.user_id = users.user_id
+			ORDER BY users.user_id, length(notes.data) DESC NULLS LAST, notes.created_at, notes.note_id
+			LIMIT $1
+		`, MaxResults+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			user                 = &User{}
+			noteID, data, status sql.NullString
+			updatedAt            sql.NullTime
+			version              sql.NullInt32
+		)
+		err := rows.Scan(&user.UserID, &user.Username, &user.Emoji, &noteID, &data, &status, &updatedAt, &version)
+		if err != nil {
+			return nil, err
+		}
+		longestRx := &UserLongestNoteResolver{u: user}
+		if noteID.Valid {
+			longestRx.n = &Note{NoteID: graphql.ID(noteID.String), Data: data.String, Status: status.String, UpdatedAt: updatedAt.Time, Version: version.Int32}
+			primeTags(ctx, &NoteResolver{longestRx.n})
+		}
+		longestRxs = append(longestRxs, longestRx)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return longestRxs[:capResults(ctx, "longestNotes", len(longestRxs))], nil
+}
+
+// DefaultTopUsers is how many users topUsers returns when the
+// client omits limit:
+const DefaultTopUsers = 3
+
+// TopUsers ranks users by how many notes they’ve written,
+// breaking ties by username so the order is stable. Users
+// without notes rank last with a count of 0:
+func (r *QueryResolver) TopUsers(ctx context.Context, args struct{ Limit *int32 }) ([]*UserNoteCountResolver, error) {
+	if args.Limit != nil && *args.Limit < 0 {
+		return nil, &ValidationError{Field: "limit", Message: "must not be negative"}
+	}
+	limit := clampResults(ctx, "limit", args.Limit, DefaultTopUsers, MaxResults)
+	countRxs := []*UserNoteCountResolver{}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.topUsers", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				u.user_id,
+				u.username,
+				u.emoji,
+				count(n.note_id)
+			FROM users u
+			LEFT JOIN notes n ON n.user_id = u.user_id
+			GROUP BY u.user_id, u.username, u.emoji
+			ORDER BY count(n.note_id) DESC, u.username
+			LIMIT $1
+		`, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		countRx := &UserNoteCountResolver{u: &User{}}
+		err := rows.Scan(&countRx.u.UserID, &countRx.u.Username, &countRx.u.Emoji, &countRx.noteCount)
+		if err != nil {
+			return nil, err
+		}
+		countRxs = append(countRxs, countRx)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return countRxs, nil
+}
+
+// DefaultTrendingNotes is how many notes trendingNotes returns
+// when the client omits limit:
+const DefaultTrendingNotes = 5
+
+// TrendingNotes ranks every user’s notes by a score that
+// favors long notes and decays with age: each character is
+// worth 0.3 and each second of age costs 0.001, so a note
+// loses about 86 points a day.
+func (r *QueryResolver) TrendingNotes(ctx context.Context, args struct{ Limit *int32 }) ([]*NoteResolver, error) {
+	if args.Limit != nil && *args.Limit < 0 {
+		return nil, &ValidationError{Field: "limit", Message: "must not be negative"}
+	}
+	limit := clampResults(ctx, "limit", args.Limit, DefaultTrendingNotes, MaxResults)
+	var noteRxs []*NoteResolver
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.trendingNotes", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			ORDER BY length(data) * 0.3 - extract(epoch FROM now() - created_at) * 0.001 DESC, note_id
+			LIMIT $1
+		`, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		note := &Note{}
+		err := rows.Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != nil {
+			return nil, err
+		}
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	primeTags(ctx, noteRxs...)
+	return nonNilNotes(noteRxs), nil
+}
+
+// randomNotes returns DefaultRandomNotes notes unless the
+// client asks for more, up to MaxRandomNotes:
+const (
+	DefaultRandomNotes = 3
+	MaxRandomNotes     = 50
+)
+
+// RandomNotes samples notes across all users. ORDER BY
+// random() shuffles the whole table, which is fine at this
+// size; a large table would want TABLESAMPLE instead.
+func (r *QueryResolver) RandomNotes(ctx context.Context, args struct{ Count *int32 }) ([]*NoteResolver, error) {
+	if args.Count != nil && *args.Count <= 0 {
+		return nil, &ValidationError{Field: "count", Message: "must be positive"}
+	}
+	count := clampResults(ctx, "count", args.Count, DefaultRandomNotes, MaxRandomNotes)
+	var noteRxs []*NoteResolver
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.randomNotes", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			ORDER BY random()
+			LIMIT $1
+		`, count)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		note := &Note{}
+		err := rows.Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != nil {
+			return nil, err
+		}
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	primeTags(ctx, noteRxs...)
+	return nonNilNotes(noteRxs), nil
+}
+
+// MaxPatternLength bounds matchNotes patterns:
+const MaxPatternLength = 100
+
+type MatchNotesArgs struct {
+	UserID  graphql.ID
+	Pattern string
+}
+
+// MatchNotes matches notes against a regex with Postgres’s ~
+// operator. A pathological regex can tie up the database, so
+// we bound the pattern’s length and compile it in Go first:
+// this rejects malformed patterns with a clear error rather
+// than a Postgres one. Go’s and Postgres’s regex syntaxes
+// mostly agree.
+func (r *QueryResolver) MatchNotes(ctx context.Context, args MatchNotesArgs) ([]*NoteResolver, error) {
+	if len(args.Pattern) > MaxPatternLength {
+		msg := fmt.Sprintf("must be at most %d characters", MaxPatternLength)
+		return nil, &ValidationError{Field: "pattern", Message: msg}
+	}
+	_, err := regexp.Compile(args.Pattern)
+	if err != nil {
+		return nil, &ValidationError{Field: "pattern", Message: "invalid regex"}
+	}
+	var noteRxs []*NoteResolver
+	var rows *sql.Rows
+	err = timeQuery(ctx, "Query.matchNotes", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			WHERE user_id = $1 AND data ~ $2
+			ORDER BY pinned DESC, position
+			LIMIT $3
+		`, args.UserID, args.Pattern, MaxResults+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		note := &Note{}
+		err := rows.Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != nil {
+			return nil, err
+		}
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	noteRxs = noteRxs[:capResults(ctx, "matchNotes", len(noteRxs))]
+	primeTags(ctx, noteRxs...)
+	return nonNilNotes(noteRxs), nil
+}
+
+type NotesWithTagsArgs struct {
+	UserID   graphql.ID
+	Tags     []string
+	MatchAll bool
+}
+
+// NotesWithTags returns a user’s notes tagged with any of the
+// tags, or all of them when matchAll is true. Tags are stored
+// lowercase, so we lowercase and dedupe the arguments; then a
+// note has all n tags when it matches n distinct tags:
+func (r *QueryResolver) NotesWithTags(ctx context.Context, args NotesWithTagsArgs) ([]*NoteResolver, error) {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range args.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	noteRxs := []*NoteResolver{}
+	if len(tags) == 0 {
+		return noteRxs, nil
+	}
+	need := 1
+	if args.MatchAll {
+		need = len(tags)
+	}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.notesWithTags", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				notes.note_id,
+				notes.data,
+				notes.status,
+				notes.updated_at,
+				notes.version
+			FROM notes
+			JOIN note_tags ON note_tags.note_id = notes.note_id
+			WHERE notes.user_id = $1 AND note_tags.tag = ANY($2)
+			GROUP BY notes.note_id, notes.data, notes.status, notes.updated_at, notes.version, notes.pinned, notes.position
+			HAVING count(DISTINCT note_tags.tag) >= $3
+			ORDER BY notes.pinned DESC, notes.position
+			LIMIT $4
+		`, args.UserID, pq.Array(tags), need, MaxResults+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		note := &Note{}
+		err := rows.Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != nil {
+			return nil, err
+		}
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	noteRxs = noteRxs[:capResults(ctx, "notesWithTags", len(noteRxs))]
+	primeTags(ctx, noteRxs...)
+	return noteRxs, nil
+}
+
+// MaxSimilarUsers caps the number of similar users returned:
+const MaxSimilarUsers = 10
+
+// SimilarUsers finds other users whose notes share words with
+// the given user’s notes, most shared words first. Words are
+// the lexemes of the 'simple' text search configuration, i.e.
+// lowercased and without punctuation.
+func (r *QueryResolver) SimilarUsers(ctx context.Context, args struct{ UserID graphql.ID }) ([]*UserResolver, error) {
+	var userRxs []*UserResolver
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.similarUsers", func() (err error) {
+		rows, err = DB.QueryContext(ctx, `
+			WITH words AS (
+				SELECT DISTINCT
+					unnest(tsvector_to_array(to_tsvector('simple', data))) AS word
+				FROM notes
+				WHERE user_id = $1
+			)
+			SELECT
+				u.user_id,
+				u.username,
+				u.emoji
+			FROM users u
+			JOIN notes n ON n.user_id = u.user_id
+			CROSS JOIN LATERAL unnest(tsvector_to_array(to_tsvector('simple', n.data))) AS w(word)
+			WHERE u.user_id <> $1 AND w.word IN (SELECT word FROM words)
+			GROUP BY u.user_id, u.username, u.emoji
+			ORDER BY count(DISTINCT w.word) DESC, u.username
+			LIMIT $2
+		`, args.UserID, MaxSimilarUsers)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user := &User{}
+		err := rows.Scan(&user.UserID, &user.Username, &user.Emoji)
+		if err != nil {
+			return nil, err
+		}
+		userRxs = append(userRxs, &UserResolver{user})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return userRxs, nil
+}
+
+type AreNoteBuddiesArgs struct {
+	UserA graphql.ID
+	UserB graphql.ID
+}
+
+// AreNoteBuddies reports whether two users have written notes
+// that share a word, using the same words as SimilarUsers.
+// && is true when two arrays overlap. A user without notes
+// has no pairs to compare, so the answer is false:
+func (r *QueryResolver) AreNoteBuddies(ctx context.Context, args AreNoteBuddiesArgs) (bool, error) {
+	var buddies bool
+	err := timeQuery(ctx, "Query.areNoteBuddies", func() error {
+		return ReadDB().QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1
+				FROM notes a
+				JOIN notes b ON b.user_id = $2
+				WHERE a.user_id = $1 AND
+					tsvector_to_array(to_tsvector('simple', a.data)) &&
+					tsvector_to_array(to_tsvector('simple', b.data))
+			)
+		`, args.UserA, args.UserB).Scan(&buddies)
+	})
+	if err != nil {
+		return false, err
+	}
+	return buddies, nil
+}
+
+// MaybeNotes returns the user’s notes with archived notes
+// replaced by null. Its type, [Note], allows null elements,
+// so a nil NoteResolver becomes null in place and the other
+// notes keep their positions. In a [Note!]! list, a single
+// nil would instead null the whole list — or, since the list
+// is non-null too, its parent — and add an error.
+//
+// The list itself is nullable too, hence the pointer.
+func (r *QueryResolver) MaybeNotes(ctx context.Context, args struct{ UserID graphql.ID }) (*[]*NoteResolver, error) {
+	noteRxs, err := memoNotes(ctx, args.UserID, nil)
+	if err != nil {
+		return nil, err
+	}
+	maybeNoteRxs := make([]*NoteResolver, len(noteRxs))
+	for x, noteRx := range noteRxs {
+		if noteRx.n.Status != "ARCHIVED" {
+			maybeNoteRxs[x] = noteRx
+		}
+	}
+	return &maybeNoteRxs, nil
+}
+
+// NotesByStatus fetches the user’s notes once and partitions
+// them in Go, rather than querying once per status:
+func (r *QueryResolver) NotesByStatus(ctx context.Context, args struct{ UserID graphql.ID }) (*NotesByStatusResolver, error) {
+	noteRxs, err := memoNotes(ctx, args.UserID, nil)
+	if err != nil {
+		return nil, err
+	}
+	byStatus := &NotesByStatusResolver{}
+	for _, noteRx := range noteRxs {
+		switch noteRx.n.Status {
+		case "DRAFT":
+			byStatus.drafts = append(byStatus.drafts, noteRx)
+		case "PUBLISHED":
+			byStatus.published = append(byStatus.published, noteRx)
+		case "ARCHIVED":
+			byStatus.archived = append(byStatus.archived, noteRx)
+		}
+	}
+	return byStatus, nil
+}
+
+type SearchNotesConnectionArgs struct {
+	Query string
+	First int32
+	After *string
+}
+
+// SearchNotesConnection ranks matching notes with Postgres
+// full-text search and pages through them with keyset
+// pagination: the cursor is the last edge’s (rank, note ID),
+// and the next page starts strictly after it. The 'simple'
+// text search configuration doesn’t stem, which suits notes
+// written in several languages.
+func (r *QueryResolver) SearchNotesConnection(ctx context.Context, args SearchNotesConnectionArgs) (*NoteConnectionResolver, error) {
+	if args.First <= 0 {
+		return nil, &ValidationError{Field: "first", Message: "must be positive"}
+	}
+	args.First = clampResults(ctx, "first", &args.First, MaxResults, MaxResults)
+	afterRank, afterNoteID := 0.0, ""
+	if args.After != nil {
+		var err error
+		afterRank, afterNoteID, err = decodeRankCursor(*args.After)
+		if err != nil {
+			return nil, &ValidationError{Field: "after", Message: "invalid cursor"}
+		}
+	}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.searchNotesConnection", func() (err error) {
+		rows, err = DB.QueryContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version,
+				rank
+			FROM (
+				SELECT
+					note_id,
+					data,
+					status,
+					updated_at,
+					version,
+					ts_rank(to_tsvector('simple', data), plainto_tsquery('simple', $1)) AS rank
+				FROM notes
+				WHERE to_tsvector('simple', data) @@ plainto_tsquery('simple', $1)
+			) AS matches
+			WHERE $2 OR (rank, note_id) < ($3::real, $4)
+			ORDER BY rank DESC, note_id DESC
+			LIMIT $5
+		`, args.Query, args.After == nil, afterRank, afterNoteID, args.First+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	conn := &NoteConnectionResolver{}
+	for rows.Next() {
+		edge := &NoteEdgeResolver{n: &Note{}}
+		err := rows.Scan(&edge.n.NoteID, &edge.n.Data, &edge.n.Status, &edge.n.UpdatedAt, &edge.n.Version, &edge.score)
+		if err != nil {
+			return nil, err
+		}
+		edge.cursor = encodeRankCursor(edge.score, edge.n.NoteID)
+		conn.edges = append(conn.edges, edge)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	// We asked for one extra edge to know whether there’s a
+	// next page:
+	if len(conn.edges) > int(args.First) {
+		conn.edges = conn.edges[:args.First]
+		conn.hasNextPage = true
+	}
+	for _, edge := range conn.edges {
+		primeTags(ctx, &NoteResolver{edge.n})
+	}
+	return conn, nil
+}
+
+// Cursors are opaque to clients; we base64-encode them so
+// they aren’t tempted to build their own.
+func encodeRankCursor(rank float64, noteID graphql.ID) string {
+	cursor := strconv.FormatFloat(rank, 'g', -1, 64) + ":" + string(noteID)
+	return base64.StdEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodeRankCursor(cursor string) (float64, string, error) {
+	bstr, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", err
+	}
+	parts := strings.SplitN(string(bstr), ":", 2)
+	if len(parts) != 2 {
+		return 0, "", errors.New("cursor: missing note ID")
+	}
+	rank, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return rank, parts[1], nil
+}
+
+type AllNotesArgs struct {
+	First int32
+	After *string
+}
+
+// AllNotes pages over every user’s notes for moderation, so
+// it’s admin-only (see @auth in main-6-schema.graphql). Notes are ordered by (created_at, note_id)
+// — note_id breaks ties — and the cursor encodes both, so
+// the next page starts strictly after the last edge. Each
+// edge joins in the note’s owner.
+func (r *QueryResolver) AllNotes(ctx context.Context, args AllNotesArgs) (*NoteConnectionResolver, error) {
+	err := authorize(ctx, "Query.allNotes")
+	if err != nil {
+		return nil, err
+	}
+	if args.First <= 0 {
+		return nil, &ValidationError{Field: "first", Message: "must be positive"}
+	}
+	args.First = clampResults(ctx, "first", &args.First, MaxResults, MaxResults)
+	afterCreatedAt, afterNoteID := time.Time{}, ""
+	if args.After != nil {
+		afterCreatedAt, afterNoteID, err = decodeTimeCursor(*args.After)
+		if err != nil {
+			return nil, &ValidationError{Field: "after", Message: "invalid cursor"}
+		}
+	}
+	var rows *sql.Rows
+	err = timeQuery(ctx, "Query.allNotes", func() (err error) {
+		rows, err = DB.QueryContext(ctx, `
+			SELECT
+				notes.note_id,
+				notes.data,
+				notes.status,
+				notes.updated_at,
+				notes.version,
+				notes.created_at,
+				users.user_id,
+				users.username,
+				users.emoji
+			FROM notes
+			JOIN users ON users.user_id = notes.user_id
+			WHERE $1 OR (notes.created_at, notes.note_id) > ($2::timestamptz, $3)
+			ORDER BY notes.created_at, notes.note_id
+			LIMIT $4
+		`, args.After == nil, afterCreatedAt, afterNoteID, args.First+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	conn := &NoteConnectionResolver{}
+	for rows.Next() {
+		edge := &NoteEdgeResolver{n: &Note{}, user: &User{}}
+		var createdAt time.Time
+		err := rows.Scan(
+			&edge.n.NoteID, &edge.n.Data, &edge.n.Status, &edge.n.UpdatedAt, &edge.n.Version, &createdAt,
+			&edge.user.UserID, &edge.user.Username, &edge.user.Emoji,
+		)
+		if err != nil {
+			return nil, err
+		}
+		edge.cursor = encodeTimeCursor(createdAt, edge.n.NoteID)
+		conn.edges = append(conn.edges, edge)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	if len(conn.edges) > int(args.First) {
+		conn.edges = conn.edges[:args.First]
+		conn.hasNextPage = true
+	}
+	for _, edge := range conn.edges {
+		primeTags(ctx, &NoteResolver{edge.n})
+	}
+	return conn, nil
+}
+
+// Time cursors are base64 "created_at noteID" strings; the
+// timestamp keeps Postgres’s microseconds:
+func encodeTimeCursor(createdAt time.Time, noteID graphql.ID) string {
+	str := createdAt.UTC().Format(time.RFC3339Nano) + " " + string(noteID)
+	return base64.StdEncoding.EncodeToString([]byte(str))
+}
+
+func decodeTimeCursor(cursor string) (time.Time, string, error) {
+	bstr, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	parts := strings.SplitN(string(bstr), " ", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", errors.New("cursor: missing note ID")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return createdAt, parts[1], nil
+}
+
+type UsersConnectionArgs struct {
+	First  *int32
+	After  *string
+	Last   *int32
+	Before *string
+}
+
+// UsersConnection pages through users by user_id in either
+// direction, as per Relay: first/after pages forward and
+// last/before pages backward. To page backward, we reverse
+// the ORDER BY, then reverse the page in Go so edges always
+// read in user_id order. Each direction learns whether there
+// are more users ahead of it by asking for one extra user,
+// and whether there are users behind it with EXISTS.
+func (r *QueryResolver) UsersConnection(ctx context.Context, args UsersConnectionArgs) (*UserConnectionResolver, error) {
+	switch {
+	case args.First != nil && args.Last != nil:
+		return nil, &ValidationError{Field: "last", Message: "cannot be combined with first"}
+	case args.First != nil && args.Before != nil:
+		return nil, &ValidationError{Field: "before", Message: "cannot be combined with first"}
+	case args.Last != nil && args.After != nil:
+		return nil, &ValidationError{Field: "after", Message: "cannot be combined with last"}
+	case args.First == nil && args.Last == nil:
+		return nil, &ValidationError{Field: "first", Message: "first or last is required"}
+	}
+	forward := args.First != nil
+	n, cursor, field, cursorField := args.First, args.After, "first", "after"
+	if !forward {
+		n, cursor, field, cursorField = args.Last, args.Before, "last", "before"
+	}
+	if *n <= 0 {
+		return nil, &ValidationError{Field: field, Message: "must be positive"}
+	}
+	limit := clampResults(ctx, field, n, MaxResults, MaxResults)
+	cursorUserID := ""
+	if cursor != nil {
+		var err error
+		cursorUserID, err = decodeUserCursor(*cursor)
+		if err != nil {
+			return nil, &ValidationError{Field: cursorField, Message: "invalid cursor"}
+		}
+	}
+	// Forward, we want users after the cursor and check for
+	// users at or before it; backward, the opposite:
+	page, behind := `user_id > $2 ORDER BY user_id`, `user_id <= $1`
+	if !forward {
+		page, behind = `user_id < $2 ORDER BY user_id DESC`, `user_id >= $1`
+	}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.usersConnection", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				user_id,
+				username,
+				emoji
+			FROM users
+			WHERE $1 OR `+page+`
+			LIMIT $3
+		`, cursor == nil, cursorUserID, limit+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	conn := &UserConnectionResolver{}
+	for rows.Next() {
+		user := &User{}
+		err := rows.Scan(&user.UserID, &user.Username, &user.Emoji)
+		if err != nil {
+			return nil, err
+		}
+		conn.edges = append(conn.edges, &UserEdgeResolver{user, encodeUserCursor(user.UserID)})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	ahead := len(conn.edges) > int(limit)
+	if ahead {
+		conn.edges = conn.edges[:limit]
+	}
+	behindExists := false
+	if cursor != nil {
+		err := timeQuery(ctx, "Query.usersConnection", func() error {
+			return ReadDB().QueryRowContext(ctx, `
+				SELECT EXISTS (
+					SELECT 1
+					FROM users
+					WHERE `+behind+`
+				)
+			`, cursorUserID).Scan(&behindExists)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if forward {
+		conn.hasNextPage, conn.hasPreviousPage = ahead, behindExists
+	} else {
+		conn.hasNextPage, conn.hasPreviousPage = behindExists, ahead
+		for x, y := 0, len(conn.edges)-1; x < y; x, y = x+1, y-1 {
+			conn.edges[x], conn.edges[y] = conn.edges[y], conn.edges[x]
+		}
+	}
+	return conn, nil
+}
+
+// User cursors are base64 "user:userID" strings:
+func encodeUserCursor(userID graphql.ID) string {
+	return base64.StdEncoding.EncodeToString([]byte("user:" + string(userID)))
+}
+
+func decodeUserCursor(cursor string) (string, error) {
+	bstr, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", err
+	}
+	userID := strings.TrimPrefix(string(bstr), "user:")
+	if userID == string(bstr) {
+		return "", errors.New("cursor: not a user cursor")
+	}
+	return userID, nil
+}
+
+func (r *QueryResolver) Stats() *StatsResolver {
+	return &StatsResolver{}
+}
+
+// ServerTime lets clients sync their clocks. DateTime
+// marshals in UTC, so the timestamp always ends in “Z”.
+func (r *QueryResolver) ServerTime() DateTime {
+	return DateTime{time.Now().UTC()}
+}
+
+// Ping probes the database through GraphQL. A failed ping is
+// an answer, not an error, so it reports ok: false along with
+// how long it took to fail.
+func (r *QueryResolver) Ping(ctx context.Context) *PingResultResolver {
+	start := time.Now()
+	err := DB.PingContext(ctx)
+	if err != nil {
+		log.Printf("DB.PingContext: %s", err)
+	}
+	return &PingResultResolver{ok: err == nil, latency: time.Since(start)}
+}
+
+// Operations lists the root query and mutation fields, so
+// clients can discover what the API offers without a full
+// introspection query. main loads it once from the schema:
+type Operations struct {
+	Queries   []string
+	Mutations []string
+}
+
+var AvailableOperations = &Operations{}
+
+func loadOperations(s *graphql.Schema) *Operations {
+	fieldNames := func(entryPoint string) []string {
+		names := []string{}
+		object, ok := s.ASTSchema().EntryPoints[entryPoint].(*types.ObjectTypeDefinition)
+		if !ok {
+			return names
+		}
+		for _, field := range object.Fields {
+			names = append(names, field.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	return &Operations{
+		Queries:   fieldNames("query"),
+		Mutations: fieldNames("mutation"),
+	}
+}
+
+func (r *QueryResolver) AvailableOperations() *OperationsResolver {
+	return &OperationsResolver{AvailableOperations}
+}
+
+// EchoInput has one of each kind of scalar, plus a nullable
+// field, so clients can check how their variables serialize:
+type EchoInput struct {
+	Text   string
+	Number int32
+	Flag   bool
+	Status string
+	Note   *string
+}
+
+// Echo returns its input as is. GraphQL doesn’t allow an
+// input type as an output type, so the result is an EchoOutput
+// with the same fields.
+func (r *QueryResolver) Echo(args struct{ Input EchoInput }) *EchoOutputResolver {
+	return &EchoOutputResolver{args.Input}
+}
+
+// Feed merges the user’s activity — joining, then creating
+// notes — into one list, oldest first, with USER_JOINED
+// sorting before NOTE_CREATED on ties. The events are
+// different types, so the feed is a list of the Activity
+// interface and clients pick out fields per type, e.g.:
+//
+//	feed(userID: $userID) {
+//		timestamp
+//		... on NoteCreated { note { data } }
+//		... on UserJoined { user { username } }
+//	}
+func (r *QueryResolver) Feed(ctx context.Context, args struct{ UserID graphql.ID }) ([]*ActivityResolver, error) {
+	var activityRxs []*ActivityResolver
+	var rows *sql.Rows
+	err := timeQuery(ctx, "Query.feed", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				'USER_JOINED',
+				created_at,
+				user_id,
+				username,
+				emoji,
+				NULL::text,
+				NULL::text,
+				NULL::text,
+				NULL::timestamptz,
+				NULL::integer
+			FROM users
+			WHERE user_id = $1
+			UNION ALL
+			SELECT
+				'NOTE_CREATED',
+				notes.created_at,
+				users.user_id,
+				users.username,
+				users.emoji,
+				notes.note_id,
+				notes.data,
+				notes.status,
+				notes.updated_at,
+				notes.version
+			FROM notes
+			JOIN users ON users.user_id = notes.user_id
+			WHERE notes.user_id = $1
+			ORDER BY 2, 1 DESC
+		`, args.UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			kind                 string
+			timestamp            time.Time
+			user                 User
+			noteID, data, status sql.NullString
+			updatedAt            sql.NullTime
+			version              sql.NullInt32
+		)
+		err := rows.Scan(&kind, &timestamp, &user.UserID, &user.Username, &user.Emoji, &noteID, &data, &status, &updatedAt, &version)
+		if err != nil {
+			return nil, err
+		}
+		activityRx := &ActivityResolver{timestamp: DateTime{timestamp}, user: &user}
+		if kind == "NOTE_CREATED" {
+			activityRx.note = &Note{NoteID: graphql.ID(noteID.String), Data: data.String, Status: status.String, UpdatedAt: updatedAt.Time, Version: version.Int32}
+		}
+		activityRxs = append(activityRxs, activityRx)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return activityRxs, nil
+}
+
+type MutationResolver struct{}
+
+// Mutations take a dryRun argument. A dry run does all the
+// work inside a transaction, then rolls it back instead of
+// committing, so clients can validate input and preview the
+// result without changing anything.
+
+// runInTx runs fn in a transaction, which it commits if fn
+// returns nil and rolls back if fn returns an error or, with
+// dryRun, regardless. A panic in fn is recovered, rolled back,
+// and returned as an error, so one bad mutation can neither
+// leave a transaction open nor take down the server.
+//
+// When the request carries an Idempotency-Key, the first
+// transaction also claims the key, so the claim commits or
+// rolls back with the mutation (see Idempotency keys).
+func runInTx(ctx context.Context, dryRun bool, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	claim := idempotencyClaimFrom(ctx)
+	claimed := false
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("runInTx: panic: %v\n%s", p, debug.Stack())
+			err = fmt.Errorf("panic: %v", p)
+		}
+		if err != nil || dryRun {
+			tx.Rollback()
+			if claimed {
+				claim.release()
+			}
+		}
+	}()
+	// A transaction is timed as a whole; its queries hold
+	// locks until it commits:
+	err = timeQuery(ctx, "runInTx", func() error {
+		if claim != nil {
+			claimed, err = claim.claim(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+	if err != nil || dryRun {
+		return err
+	}
+	return tx.Commit()
+}
+
+type CreateUserArgs struct {
+	Username string
+	Emoji    string
+	DryRun   bool
+}
+
+func (r *MutationResolver) CreateUser(ctx context.Context, args CreateUserArgs) (*UserResolver, error) {
+	err := requireEnabled("createUser")
+	if err != nil {
+		return nil, err
+	}
+	emoji, err := normalizeEmoji(args.Emoji)
+	if err != nil {
+		return nil, err
+	}
+	user := &User{}
+	err = runInTx(ctx, args.DryRun, func(tx *sql.Tx) error {
+		return tx.QueryRow(`
+			INSERT INTO users (
+				username,
+				emoji )
+			VALUES ($1, $2)
+			RETURNING
+				user_id,
+				username,
+				emoji
+		`, args.Username, emoji).Scan(&user.UserID, &user.Username, &user.Emoji)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &UserResolver{user}, nil
+}
+
+// CreateUserValidated is CreateUser for forms: rather than
+// failing on the first bad field, it checks every field and
+// returns all of the problems as userErrors, with a null
+// user. Clients can then mark every bad field at once.
+
+type NewUserInput struct {
+	Username string
+	Emoji    string
+}
+
+type CreateUserValidatedArgs struct {
+	Input  NewUserInput
+	DryRun bool
+}
+
+func (r *MutationResolver) CreateUserValidated(ctx context.Context, args CreateUserValidatedArgs) (*UserPayloadResolver, error) {
+	err := requireEnabled("createUserValidated")
+	if err != nil {
+		return nil, err
+	}
+	payload := &UserPayloadResolver{}
+	err = runInTx(ctx, args.DryRun, func(tx *sql.Tx) error {
+		usernameErr, err := validateUsername(ctx, tx, args.Input.Username)
+		if err != nil {
+			return err
+		} else if usernameErr != nil {
+			payload.userErrors = append(payload.userErrors, usernameErr)
+		}
+		emoji, err := normalizeEmoji(args.Input.Emoji)
+		var emojiErr *ValidationError
+		if errors.As(err, &emojiErr) {
+			payload.userErrors = append(payload.userErrors, emojiErr)
+		} else if err != nil {
+			return err
+		}
+		if len(payload.userErrors) > 0 {
+			return nil
+		}
+		payload.user = &User{}
+		return tx.QueryRow(`
+			INSERT INTO users (
+				username,
+				emoji )
+			VALUES ($1, $2)
+			RETURNING
+				user_id,
+				username,
+				emoji
+		`, args.Input.Username, emoji).Scan(&payload.user.UserID, &payload.user.Username, &payload.user.Emoji)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// validateUsername mirrors the check constraint on
+// users.username (see main-6-schema.sql) and checks that the
+// username isn’t taken. The unique constraint still has the
+// final say should two requests race.
+func validateUsername(ctx context.Context, q Queryer, username string) (*ValidationError, error) {
+	if n := utf8.RuneCountInString(username); n < 3 || n > 8 {
+		return &ValidationError{Field: "username", Message: "must be 3-8 characters"}, nil
+	}
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return &ValidationError{Field: "username", Message: "must only contain letters, digits, and underscores"}, nil
+		}
+	}
+	var taken bool
+	err := timeQuery(ctx, "validateUsername", func() error {
+		return q.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1
+				FROM users
+				WHERE lower(username) = lower($1)
+			)
+		`, username).Scan(&taken)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return &ValidationError{Field: "username", Message: "is taken"}, nil
+	}
+	return nil, nil
+}
+
+type DeleteUserArgs struct {
+	UserID graphql.ID
+	DryRun bool
+}
+
+// DeleteUser deletes a user; their notes are deleted by the
+// ON DELETE CASCADE foreign key (see main-6-schema.sql).
+func (r *MutationResolver) DeleteUser(ctx context.Context, args DeleteUserArgs) (graphql.ID, error) {
+	err := requireEnabled("deleteUser")
+	if err != nil {
+		return "", err
+	}
+	var userID graphql.ID
+	err = runInTx(ctx, args.DryRun, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`
+			DELETE FROM users
+			WHERE user_id = $1
+			RETURNING user_id
+		`, args.UserID).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return localizedError(ctx, CodeUserNotFound)
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+type CreateNoteArgs struct {
+	UserID graphql.ID
+	Note   NoteInput
+	DryRun bool
+}
+
+func (r *MutationResolver) CreateNote(ctx context.Context, args CreateNoteArgs) (*NoteResolver, error) {
+	err := requireEnabled("createNote")
+	if err != nil {
+		return nil, err
+	}
+	err = checkUTF8("data", args.Note.Data)
+	if err != nil {
+		return nil, err
+	}
+	err = checkBlocklist(args.Note.Data)
+	if err != nil {
+		return nil, err
+	}
+	note := &Note{}
+	err = runInTx(ctx, args.DryRun, func(tx *sql.Tx) error {
+		return tx.QueryRow(`
+			INSERT INTO notes (
+				user_id,
+				data )
+			VALUES ($1, $2)
+			RETURNING
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+		`, args.UserID, args.Note.Data).Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !args.DryRun {
+		broker.Publish(args.UserID, note)
+	}
+	return &NoteResolver{note}, nil
+}
+
+type DuplicateNoteArgs struct {
+	NoteID graphql.ID
+	DryRun bool
+}
+
+// DuplicateNote copies a note for the same user. The copy’s
+// data ends in " (copy)" so the two are easy to tell apart.
+func (r *MutationResolver) DuplicateNote(ctx context.Context, args DuplicateNoteArgs) (*NoteResolver, error) {
+	err := requireEnabled("duplicateNote")
+	if err != nil {
+		return nil, err
+	}
+	note := &Note{}
+	err = runInTx(ctx, args.DryRun, func(tx *sql.Tx) error {
+		var userID graphql.ID
+		original := &Note{}
+		err := tx.QueryRow(`
+			SELECT
+				user_id,
+				data,
+				status
+			FROM notes
+			WHERE note_id = $1
+			FOR SHARE
+		`, args.NoteID).Scan(&userID, &original.Data, &original.Status)
+		if err == sql.ErrNoRows {
+			return localizedError(ctx, CodeNoteNotFound)
+		} else if err != nil {
+			return err
+		}
+		return tx.QueryRow(`
+			INSERT INTO notes (
+				user_id,
+				data,
+				status )
+			VALUES ($1, $2, $3)
+			RETURNING
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+		`, userID, original.Data+" (copy)", original.Status).Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &NoteResolver{note}, nil
+}
+
+type UpdateNoteIfVersionArgs struct {
+	NoteID          graphql.ID
+	Data            string
+	ExpectedVersion int32
+	DryRun          bool
+}
+
+// UpdateNoteIfVersion is an optimistic update: it only writes
+// when the client read the latest version. Two clients editing
+// the same note can’t silently overwrite each other; the second
+// one gets a CONFLICT and should refetch:
+func (r *MutationResolver) UpdateNoteIfVersion(ctx context.Context, args UpdateNoteIfVersionArgs) (*NoteResolver, error) {
+	err := requireEnabled("updateNoteIfVersion")
+	if err != nil {
+		return nil, err
+	}
+	err = checkUTF8("data", args.Data)
+	if err != nil {
+		return nil, err
+	}
+	err = checkBlocklist(args.Data)
+	if err != nil {
+		return nil, err
+	}
+	note := &Note{}
+	err = runInTx(ctx, args.DryRun, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`
+			UPDATE notes
+			SET data = $2
+			WHERE note_id = $1 AND version = $3
+			RETURNING
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+		`, args.NoteID, args.Data, args.ExpectedVersion).Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != sql.ErrNoRows {
+			return err
+		}
+		// Zero rows means either there’s no such note or the
+		// version moved on:
+		var version int32
+		err = tx.QueryRow(`
+			SELECT version
+			FROM notes
+			WHERE note_id = $1
+		`, args.NoteID).Scan(&version)
+		if err == sql.ErrNoRows {
+			return localizedError(ctx, CodeNoteNotFound)
+		} else if err != nil {
+			return err
+		}
+		return &ConflictError{Current: version, Expected: args.ExpectedVersion}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &NoteResolver{note}, nil
+}
+
+// Each user can pin at most -max-pinned-notes notes:
+var maxPinnedNotes = flag.Int("max-pinned-notes", 3, "max pinned notes per user")
+
+type PinNoteArgs struct {
+	NoteID graphql.ID
+	Pinned bool
+	DryRun bool
+}
+
+// PinNote pins or unpins a note; pinned notes list first (see
+// queryNotes). We lock the note, so transferNotes can’t move it
+// to another user under us, then its owner’s row, so two
+// concurrent pins can’t both see room for one more pinned
+// note. transferNotes locks in the same order, notes then
+// users, so the two can’t deadlock.
+func (r *MutationResolver) PinNote(ctx context.Context, args PinNoteArgs) (*NoteResolver, error) {
+	err := requireEnabled("pinNote")
+	if err != nil {
+		return nil, err
+	}
+	note := &Note{}
+	err = runInTx(ctx, args.DryRun, func(tx *sql.Tx) error {
+		var userID graphql.ID
+		err := tx.QueryRow(`
+			SELECT
+				user_id
+			FROM notes
+			WHERE note_id = $1
+			FOR UPDATE
+		`, args.NoteID).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return localizedError(ctx, CodeNoteNotFound)
+		} else if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			SELECT 1
+			FROM users
+			WHERE user_id = $1
+			FOR UPDATE
+		`, userID)
+		if err != nil {
+			return err
+		}
+		var pinnedCount int
+		err = tx.QueryRow(`
+			SELECT count(*)
+			FROM notes
+			WHERE user_id = $1 AND pinned AND note_id <> $2
+		`, userID, args.NoteID).Scan(&pinnedCount)
+		if err != nil {
+			return err
+		}
+		if args.Pinned && pinnedCount >= *maxPinnedNotes {
+			msg := fmt.Sprintf("at most %d notes can be pinned; unpin one first", *maxPinnedNotes)
+			return &ValidationError{Field: "pinned", Message: msg}
+		}
+		return tx.QueryRow(`
+			UPDATE notes
+			SET pinned = $2
+			WHERE note_id = $1
+			RETURNING
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+		`, args.NoteID, args.Pinned).Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &NoteResolver{note}, nil
+}
+
+type ReorderNotesArgs struct {
+	UserID         graphql.ID
+	OrderedNoteIDs []graphql.ID
+	DryRun         bool
+}
+
+func (r *MutationResolver) ReorderNotes(ctx context.Context, args ReorderNotesArgs) ([]*NoteResolver, error) {
+	err := requireEnabled("reorderNotes")
+	if err != nil {
+		return nil, err
+	}
+	var noteRxs []*NoteResolver
+	err = runInTx(ctx, args.DryRun, func(tx *sql.Tx) error {
+		// Lock the user’s notes so they can’t change underneath
+		// us:
+		rows, err := tx.Query(`
+			SELECT
+				note_id
+			FROM notes
+			WHERE user_id = $1
+			FOR UPDATE
+		`, args.UserID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		owned := map[graphql.ID]bool{}
+		for rows.Next() {
+			var noteID graphql.ID
+			err := rows.Scan(&noteID)
+			if err != nil {
+				return err
+			}
+			owned[noteID] = true
+		}
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+		// The ordered note IDs must be exactly the user’s notes:
+		if len(args.OrderedNoteIDs) != len(owned) {
+			return &ValidationError{Field: "orderedNoteIDs", Message: "must list each of the user’s notes exactly once"}
+		}
+		seen := map[graphql.ID]bool{}
+		for _, noteID := range args.OrderedNoteIDs {
+			if !owned[noteID] || seen[noteID] {
+				return &ValidationError{Field: "orderedNoteIDs", Message: "must list each of the user’s notes exactly once"}
+			}
+			seen[noteID] = true
+		}
+		for position, noteID := range args.OrderedNoteIDs {
+			_, err := tx.Exec(`
+				UPDATE notes
+				SET position = $1
+				WHERE note_id = $2
+			`, position, noteID)
+			if err != nil {
+				return err
+			}
+		}
+		noteRxs, err = queryNotes(ctx, tx, args.UserID, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nonNilNotes(noteRxs), nil
+}
+
+type TransferNotesArgs struct {
+	FromUserID graphql.ID
+	ToUserID   graphql.ID
+	NoteIDs    []graphql.ID
+	DryRun     bool
+}
+
+// TransferNotes moves the given notes from one user to another.
+// It’s all or nothing: one note that isn’t the source user’s
+// aborts the whole transfer. Transferred notes are unpinned so
+// they can’t push the receiving user past -max-pinned-notes:
+func (r *MutationResolver) TransferNotes(ctx context.Context, args TransferNotesArgs) ([]*NoteResolver, error) {
+	err := requireEnabled("transferNotes")
+	if err != nil {
+		return nil, err
+	}
+	if args.FromUserID == args.ToUserID {
+		return nil, &ValidationError{Field: "toUserID", Message: "must differ from fromUserID"}
+	}
+	if len(args.NoteIDs) == 0 {
+		return nil, &ValidationError{Field: "noteIDs", Message: "must list at least one note"}
+	}
+	var noteRxs []*NoteResolver
+	err = runInTx(ctx, args.DryRun, func(tx *sql.Tx) error {
+		// Lock the notes, then both users, each in a fixed order
+		// so two opposite transfers can’t deadlock, nor can a
+		// transfer and a pinNote (which also locks the note
+		// before its user):
+		noteIDs := append([]graphql.ID(nil), args.NoteIDs...)
+		sort.Slice(noteIDs, func(i, j int) bool { return noteIDs[i] < noteIDs[j] })
+		seen := map[graphql.ID]bool{}
+		for _, noteID := range noteIDs {
+			if seen[noteID] {
+				msg := fmt.Sprintf("note %s is listed more than once", noteID)
+				return &ValidationError{Field: "noteIDs", Message: msg}
+			}
+			seen[noteID] = true
+			var userID graphql.ID
+			err := tx.QueryRow(`
+				SELECT
+					user_id
+				FROM notes
+				WHERE note_id = $1
+				FOR UPDATE
+			`, noteID).Scan(&userID)
+			if err == sql.ErrNoRows {
+				msg := fmt.Sprintf("note %s does not exist", noteID)
+				return &ValidationError{Field: "noteIDs", Message: msg}
+			} else if err != nil {
+				return err
+			}
+			if userID != args.FromUserID {
+				msg := fmt.Sprintf("note %s does not belong to user %s", noteID, args.FromUserID)
+				return &ValidationError{Field: "noteIDs", Message: msg}
+			}
+		}
+		rows, err := tx.Query(`
+			SELECT
+				user_id
+			FROM users
+			WHERE user_id IN ($1, $2)
+			ORDER BY user_id
+			FOR UPDATE
+		`, args.FromUserID, args.ToUserID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		found := 0
+		for rows.Next() {
+			found++
+		}
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+		if found != 2 {
+			return localizedError(ctx, CodeUserNotFound)
+		}
+		for _, noteID := range args.NoteIDs {
+			note := &Note{}
+			err := tx.QueryRow(`
+				UPDATE notes
+				SET
+					user_id = $2,
+					pinned = false
+				WHERE note_id = $1
+				RETURNING
+					note_id,
+					data,
+					status,
+					updated_at,
+					version
+			`, noteID, args.ToUserID).Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+			if err != nil {
+				return err
+			}
+			noteRxs = append(noteRxs, &NoteResolver{note})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	primeTags(ctx, noteRxs...)
+	return nonNilNotes(noteRxs), nil
+}
+
+// ExportToken issues a token for GET /export/notes?token=...
+// that exports the user’s notes until it expires (see
+// Export). A token reads every note the user has, so only
+// admins can issue one; anyone else gets “forbidden”.
+func (r *MutationResolver) ExportToken(ctx context.Context, args struct{ UserID graphql.ID }) (string, error) {
+	err := requireEnabled("exportToken")
+	if err != nil {
+		return "", err
+	}
+	err = requireAdmin(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(ExportTokenSecret) == 0 {
+		return "", ErrExportDisabled
+	}
+	var exists bool
+	err = timeQuery(ctx, "Mutation.exportToken", func() error {
+		return DB.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1
+				FROM users
+				WHERE user_id = $1
+			)
+		`, args.UserID).Scan(&exists)
+	})
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", localizedError(ctx, CodeUserNotFound)
+	}
+	return signExportToken(args.UserID, time.Now().Add(ExportTokenTTL)), nil
+}
+
+// The mock data from main-5, as loaded by main-6-schema.sql:
+var seedUsers = []struct {
+	Username string
+	Emoji    string
+	Notes    []string
+}{
+	{"nyxerys", "🇵🇹", []string{"Olá Mundo!", "Olá novamente, mundo!", "Olá, escuridão!"}},
+	{"rdnkta", "🇺🇦", []string{"Привіт Світ!", "Привіт ще раз, світ!", "Привіт, темрява!"}},
+	{"zaydek", "🇺🇸", []string{"Hello, world!", "Hello again, world!", "Hello, darkness!"}},
+}
+
+// seedTags tag the mock notes whose data matches the pattern,
+// like main-6-schema.sql does:
+var seedTags = []struct {
+	Tag     string
+	Pattern string
+}{
+	{"world", "mundo|світ|world"},
+	{"again", "novamente|ще раз|again"},
+	{"darkness", "escuridão|темрява|darkness"},
+}
+
+var ErrReseedDisabled = errors.New("reseed is disabled; set ALLOW_RESEED=true to enable it")
+
+// Reseed wipes the database and reloads the mock data, which
+// makes demos and tests reproducible. Because it destroys
+// data, it’s for admins only and refuses to run unless
+// ALLOW_RESEED=true.
+func (r *MutationResolver) Reseed(ctx context.Context) (bool, error) {
+	err := requireEnabled("reseed")
+	if err != nil {
+		return false, err
+	}
+	err = requireAdmin(ctx)
+	if err != nil {
+		return false, err
+	}
+	if os.Getenv("ALLOW_RESEED") != "true" {
+		return false, ErrReseedDisabled
+	}
+	err = runInTx(ctx, false, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`TRUNCATE note_tags, notes, users`)
+		if err != nil {
+			return err
+		}
+		for _, seed := range seedUsers {
+			var userID string
+			err := tx.QueryRow(`
+				INSERT INTO users (
+					username,
+					emoji )
+				VALUES ($1, $2)
+				RETURNING user_id
+			`, seed.Username, seed.Emoji).Scan(&userID)
+			if err != nil {
+				return err
+			}
+			for _, data := range seed.Notes {
+				_, err := tx.Exec(`
+					INSERT INTO notes (
+						user_id,
+						data )
+					VALUES ($1, $2)
+				`, userID, data)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for _, seed := range seedTags {
+			_, err := tx.Exec(`
+				INSERT INTO note_tags (
+					note_id,
+					tag )
+				SELECT note_id, $1
+				FROM notes
+				WHERE data ~* $2
+			`, seed.Tag, seed.Pattern)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+/*
+ * UserResolver
+ */
+
+type UserResolver struct{ u *User }
+
+func (r *UserResolver) UserID() graphql.ID {
+	return r.u.UserID
+}
+
+func (r *UserResolver) Username() string {
+	return r.u.Username
+}
+
+func (r *UserResolver) Emoji() string {
+	return r.u.Emoji
+}
+
+// Notes uses eagerly loaded notes when there are any (see
+// QueryResolver.Users) and otherwise queries them:
+func (r *UserResolver) Notes(ctx context.Context) ([]*NoteResolver, error) {
+	if r.u.Notes != nil {
+		var noteRxs []*NoteResolver
+		for _, note := range r.u.Notes {
+			noteRxs = append(noteRxs, &NoteResolver{note})
+		}
+		primeTags(ctx, noteRxs...)
+		return nonNilNotes(noteRxs), nil
+	}
+	return memoNotes(ctx, r.u.UserID, nil)
+}
+
+// Journal is the user’s notes as one plain-text document,
+// one note per line. string_agg over no rows is null, hence
+// the coalesce to an empty string.
+func (r *UserResolver) Journal(ctx context.Context) (string, error) {
+	var journal string
+	err := timeQuery(ctx, "User.journal", func() error {
+		return ReadDB().QueryRowContext(ctx, `
+			SELECT coalesce(string_agg(data, E'\n' ORDER BY created_at, position), '')
+			FROM notes
+			WHERE user_id = $1
+		`, r.u.UserID).Scan(&journal)
+	})
+	if err != nil {
+		return "", err
+	}
+	return journal, nil
+}
+
+// NoteStats computes the stats in one query: the window
+// functions aggregate over all of the user’s notes while the
+// ORDER BY and LIMIT pick out the longest one. A user with
+// no notes has no rows, hence zeros and a null longest note.
+func (r *UserResolver) NoteStats(ctx context.Context) (*NoteStatsResolver, error) {
+	stats := &NoteStatsResolver{}
+	note := &Note{}
+	err := timeQuery(ctx, "User.noteStats", func() error {
+		return DB.QueryRowContext(ctx, `
+			SELECT
+				count(*) OVER (),
+				avg(length(data)) OVER (),
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			WHERE user_id = $1
+			ORDER BY length(data) DESC, note_id
+			LIMIT 1
+		`, r.u.UserID).Scan(&stats.total, &stats.averageLength, &note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+	})
+	if err == sql.ErrNoRows {
+		return stats, nil
+	} else if err != nil {
+		return nil, err
+	}
+	stats.longest = note
+	return stats, nil
+}
+
+// notePages has DefaultPageSize notes a page unless the client
+// asks for more, up to MaxPageSize:
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 100
+)
+
+type NotePagesArgs struct {
+	PageSize *int32
+	Page     int32
+}
+
+// NotePages pages through the user’s notes by page number,
+// for clients that prefer “page 3 of 7” to cursors. Offsets
+// are simple but can skip or repeat notes when notes are
+// added between requests, which cursors (see allNotes) avoid.
+func (r *UserResolver) NotePages(ctx context.Context, args NotePagesArgs) (*NotePageResolver, error) {
+	if args.PageSize != nil && *args.PageSize <= 0 {
+		return nil, &ValidationError{Field: "pageSize", Message: "must be positive"}
+	}
+	if args.Page <= 0 {
+		return nil, &ValidationError{Field: "page", Message: "must be positive"}
+	}
+	pageSize := clampResults(ctx, "pageSize", args.PageSize, DefaultPageSize, MaxPageSize)
+	var total int32
+	err := timeQuery(ctx, "User.notePages", func() error {
+		return ReadDB().QueryRowContext(ctx, `
+			SELECT count(*)
+			FROM notes
+			WHERE user_id = $1
+		`, r.u.UserID).Scan(&total)
+	})
+	if err != nil {
+		return nil, err
+	}
+	page := &NotePageResolver{
+		items:       []*NoteResolver{},
+		totalPages:  (total + pageSize - 1) / pageSize,
+		currentPage: args.Page,
+	}
+	var rows *sql.Rows
+	err = timeQuery(ctx, "User.notePages", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				note_id,
+				data,
+				status,
+				updated_at,
+				version
+			FROM notes
+			WHERE user_id = $1
+			ORDER BY pinned DESC, position
+			LIMIT $2 OFFSET $3
+		`, r.u.UserID, pageSize, int64(args.Page-1)*int64(pageSize))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		note := &Note{}
+		err := rows.Scan(&note.NoteID, &note.Data, &note.Status, &note.UpdatedAt, &note.Version)
+		if err != nil {
+			return nil, err
+		}
+		page.items = append(page.items, &NoteResolver{note})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	primeTags(ctx, page.items...)
+	return page, nil
+}
+
+/*
+ * UserPayloadResolver
+ */
+
+type UserPayloadResolver struct {
+	user       *User
+	userErrors []*ValidationError
+}
+
+func (r *UserPayloadResolver) User() *UserResolver {
+	if r.user == nil {
+		return nil
+	}
+	return &UserResolver{r.user}
+}
+
+func (r *UserPayloadResolver) UserErrors() []*UserErrorResolver {
+	userErrorRxs := []*UserErrorResolver{}
+	for _, e := range r.userErrors {
+		userErrorRxs = append(userErrorRxs, &UserErrorResolver{e})
+	}
+	return userErrorRxs
+}
+
+type UserErrorResolver struct{ e *ValidationError }
+
+func (r *UserErrorResolver) Field() string {
+	return r.e.Field
+}
+
+func (r *UserErrorResolver) Message() string {
+	return r.e.Message
+}
+
+/*
+ * NoteResolver
+ */
+
+type NoteResolver struct{ n *Note }
+
+func (r *NoteResolver) NoteID() graphql.ID {
+	return r.n.NoteID
+}
+
+func (r *NoteResolver) Data() string {
+	return r.n.Data
+}
+
+func (r *NoteResolver) Status() string {
+	return r.n.Status
+}
+
+// Tags come from the request’s tag loader (see loadTags):
+func (r *NoteResolver) Tags(ctx context.Context) ([]string, error) {
+	return loadTags(ctx, r.n.NoteID)
+}
+
+// Neighbors returns the notes before and after this one in
+// the user’s list, in the order notes lists them (pinned
+// first, then by position). LAG and LEAD read the previous
+// and next rows of that ordering; at either end they’re null,
+// and so is the neighbor.
+func (r *NoteResolver) Neighbors(ctx context.Context) (*NoteNeighborsResolver, error) {
+	var (
+		prevID, prevData, prevStatus, nextID, nextData, nextStatus sql.NullString
+		prevUpdatedAt, nextUpdatedAt                               sql.NullTime
+		prevVersion, nextVersion                                   sql.NullInt32
+	)
+	err := timeQuery(ctx, "Note.neighbors", func() error {
+		return ReadDB().QueryRowContext(ctx, `
+			WITH ordered AS (
+				SELECT
+					note_id,
+					lag(note_id) OVER w AS prev_id,
+					lead(note_id) OVER w AS next_id
+				FROM notes
+				WHERE user_id = (SELECT user_id FROM notes WHERE note_id = $1)
+				WINDOW w AS (ORDER BY pinned DESC, position)
+			)
+			SELECT
+				p.note_id,
+				p.data,
+				p.status,
+				p.updated_at,
+				p.version,
+				n.note_id,
+				n.data,
+				n.status,
+				n.updated_at,
+				n.version
+			FROM ordered
+			LEFT JOIN notes p ON p.note_id = ordered.prev_id
+			LEFT JOIN notes n ON n.note_id = ordered.next_id
+			WHERE ordered.note_id = $1
+		`, r.n.NoteID).Scan(&prevID, &prevData, &prevStatus, &prevUpdatedAt, &prevVersion, &nextID, &nextData, &nextStatus, &nextUpdatedAt, &nextVersion)
+	})
+	if err != nil {
+		return nil, err
+	}
+	neighbors := &NoteNeighborsResolver{}
+	if prevID.Valid {
+		neighbors.previous = &Note{NoteID: graphql.ID(prevID.String), Data: prevData.String, Status: prevStatus.String, UpdatedAt: prevUpdatedAt.Time, Version: prevVersion.Int32}
+	}
+	if nextID.Valid {
+		neighbors.next = &Note{NoteID: graphql.ID(nextID.String), Data: nextData.String, Status: nextStatus.String, UpdatedAt: nextUpdatedAt.Time, Version: nextVersion.Int32}
+	}
+	return neighbors, nil
+}
+
+// UpdatedAt is loaded with the note, so sync clients can send
+// it back to notesModifiedSince:
+func (r *NoteResolver) UpdatedAt() DateTime {
+	return DateTime{r.n.UpdatedAt}
+}
+
+// Version is loaded with the note, so clients can send it
+// back to updateNoteIfVersion:
+func (r *NoteResolver) Version() int32 {
+	return r.n.Version
+}
+
+// WordCount counts whitespace-separated words; strings.Fields
+// splits on Unicode whitespace, so "Привіт ще раз" is 3.
+func (r *NoteResolver) WordCount() int32 {
+	return int32(len(strings.Fields(r.n.Data)))
+}
+
+// CharCount counts runes, not bytes: "Привіт" is 6
+// characters but 12 bytes.
+func (r *NoteResolver) CharCount() int32 {
+	return int32(utf8.RuneCountInString(r.n.Data))
+}
+
+type DataChunkArgs struct {
+	Offset int32
+	Length int32
+}
+
+// DataChunk returns up to length characters of the note’s
+// data starting at offset, so clients can fetch a long note a
+// piece at a time. Like CharCount, it counts runes, so a
+// chunk never splits a character. A chunk that runs past the
+// end is cut short; one that starts past the end is empty.
+func (r *NoteResolver) DataChunk(args DataChunkArgs) (string, error) {
+	if args.Offset < 0 {
+		return "", &ValidationError{Field: "offset", Message: "must not be negative"}
+	}
+	if args.Length < 0 {
+		return "", &ValidationError{Field: "length", Message: "must not be negative"}
+	}
+	runes := []rune(r.n.Data)
+	start := int(args.Offset)
+	if start > len(runes) {
+		start = len(runes)
+	}
+	end := start + int(args.Length)
+	if end > len(runes) {
+		end = len(runes)
+	}
+	return string(runes[start:end]), nil
+}
+
+/*
+ * NoteNeighborsResolver
+ */
+
+type NoteNeighborsResolver struct {
+	previous *Note
+	next     *Note
+}
+
+func (r *NoteNeighborsResolver) Previous() *NoteResolver {
+	if r.previous == nil {
+		return nil
+	}
+	return &NoteResolver{r.previous}
+}
+
+func (r *NoteNeighborsResolver) Next() *NoteResolver {
+	if r.next == nil {
+		return nil
+	}
+	return &NoteResolver{r.next}
+}
+
+/*
+ * NoteStatsResolver
+ */
+
+type NoteStatsResolver struct {
+	total         int32
+	averageLength float64
+	longest       *Note
+}
+
+func (r *NoteStatsResolver) Total() int32 {
+	return r.total
+}
+
+func (r *NoteStatsResolver) AverageLength() float64 {
+	return r.averageLength
+}
+
+func (r *NoteStatsResolver) Longest() *NoteResolver {
+	if r.longest == nil {
+		return nil
+	}
+	return &NoteResolver{r.longest}
+}
+
+/*
+ * NotePageResolver
+ */
+
+type NotePageResolver struct {
+	items       []*NoteResolver
+	totalPages  int32
+	currentPage int32
+}
+
+func (r *NotePageResolver) Items() []*NoteResolver {
+	return r.items
+}
+
+func (r *NotePageResolver) TotalPages() int32 {
+	return r.totalPages
+}
+
+func (r *NotePageResolver) CurrentPage() int32 {
+	return r.currentPage
+}
+
+/*
+ * NotesByStatusResolver
+ */
+
+type NotesByStatusResolver struct {
+	drafts    []*NoteResolver
+	published []*NoteResolver
+	archived  []*NoteResolver
+}
+
+func (r *NotesByStatusResolver) Drafts() []*NoteResolver {
+	return nonNilNotes(r.drafts)
+}
+
+func (r *NotesByStatusResolver) Published() []*NoteResolver {
+	return nonNilNotes(r.published)
+}
+
+func (r *NotesByStatusResolver) Archived() []*NoteResolver {
+	return nonNilNotes(r.archived)
+}
+
+/*
+ * CountryCountResolver
+ */
+
+type CountryCountResolver struct {
+	emoji string
+	count int32
+}
+
+func (r *CountryCountResolver) Emoji() string {
+	return r.emoji
+}
+
+func (r *CountryCountResolver) Count() int32 {
+	return r.count
+}
+
+/*
+ * SearchResultsResolver
+ */
+
+type SearchResultsResolver struct {
+	users []*UserResolver
+	notes []*NoteResolver
+}
+
+func (r *SearchResultsResolver) Users() []*UserResolver {
+	return r.users
+}
+
+func (r *SearchResultsResolver) Notes() []*NoteResolver {
+	return r.notes
+}
+
+/*
+ * HistogramBucketResolver
+ */
+
+type HistogramBucketResolver struct {
+	min   int32
+	max   int32
+	count int32
+}
+
+func (r *HistogramBucketResolver) Min() int32 {
+	return r.min
+}
+
+func (r *HistogramBucketResolver) Max() int32 {
+	return r.max
+}
+
+func (r *HistogramBucketResolver) Count() int32 {
+	return r.count
+}
+
+/*
+ * UserLongestNoteResolver
+ */
+
+type UserLongestNoteResolver struct {
+	u *User
+	n *Note // nil when the user has no notes.
+}
+
+func (r *UserLongestNoteResolver) User() *UserResolver {
+	return &UserResolver{r.u}
+}
+
+func (r *UserLongestNoteResolver) Note() *NoteResolver {
+	if r.n == nil {
+		return nil
+	}
+	return &NoteResolver{r.n}
+}
+
+/*
+ * UserNoteCountResolver
+ */
+
+type UserNoteCountResolver struct {
+	u         *User
+	noteCount int32
+}
+
+func (r *UserNoteCountResolver) User() *UserResolver {
+	return &UserResolver{r.u}
+}
+
+func (r *UserNoteCountResolver) NoteCount() int32 {
+	return r.noteCount
+}
+
+/*
+ * NoteConnectionResolver
+ */
+
+type NoteConnectionResolver struct {
+	edges       []*NoteEdgeResolver
+	hasNextPage bool
+}
+
+func (r *NoteConnectionResolver) Edges() []*NoteEdgeResolver {
+	return r.edges
+}
+
+func (r *NoteConnectionResolver) PageInfo() *PageInfoResolver {
+	pageInfo := &PageInfoResolver{hasNextPage: r.hasNextPage}
+	if len(r.edges) > 0 {
+		pageInfo.startCursor = &r.edges[0].cursor
+		pageInfo.endCursor = &r.edges[len(r.edges)-1].cursor
+	}
+	return pageInfo
+}
+
+// score is the search rank (see SearchNotesConnection) and
+// user is the note’s owner (see AllNotes); each is only set
+// by the connection that provides it.
+type NoteEdgeResolver struct {
+	n      *Note
+	user   *User
+	score  float64
+	cursor string
+}
+
+func (r *NoteEdgeResolver) Cursor() string {
+	return r.cursor
+}
+
+func (r *NoteEdgeResolver) Score() float64 {
+	return r.score
+}
+
+func (r *NoteEdgeResolver) Node() *NoteResolver {
+	return &NoteResolver{r.n}
+}
+
+func (r *NoteEdgeResolver) User() *UserResolver {
+	if r.user == nil {
+		return nil
+	}
+	return &UserResolver{r.user}
+}
+
+/*
+ * UserConnectionResolver
+ */
+
+type UserConnectionResolver struct {
+	edges           []*UserEdgeResolver
+	hasNextPage     bool
+	hasPreviousPage bool
+}
+
+func (r *UserConnectionResolver) Edges() []*UserEdgeResolver {
+	return r.edges
+}
+
+func (r *UserConnectionResolver) PageInfo() *PageInfoResolver {
+	pageInfo := &PageInfoResolver{hasNextPage: r.hasNextPage, hasPreviousPage: r.hasPreviousPage}
+	if len(r.edges) > 0 {
+		pageInfo.startCursor = &r.edges[0].cursor
+		pageInfo.endCursor = &r.edges[len(r.edges)-1].cursor
+	}
+	return pageInfo
+}
+
+type UserEdgeResolver struct {
+	u      *User
+	cursor string
+}
+
+func (r *UserEdgeResolver) Cursor() string {
+	return r.cursor
+}
+
+func (r *UserEdgeResolver) Node() *UserResolver {
+	return &UserResolver{r.u}
+}
+
+// Note connections only page forward, so their
+// hasPreviousPage is always false.
+type PageInfoResolver struct {
+	hasNextPage     bool
+	hasPreviousPage bool
+	startCursor     *string
+	endCursor       *string
+}
+
+func (r *PageInfoResolver) HasNextPage() bool {
+	return r.hasNextPage
+}
+
+func (r *PageInfoResolver) HasPreviousPage() bool {
+	return r.hasPreviousPage
+}
+
+func (r *PageInfoResolver) StartCursor() *string {
+	return r.startCursor
+}
+
+func (r *PageInfoResolver) EndCursor() *string {
+	return r.endCursor
+}
+
+/*
+ * ActivityResolver
+ *
+ * interface Activity {
+ * 	id: ID!
+ * 	timestamp: DateTime!
+ * }
+ *
+ * graphql-go resolves an interface with one resolver that
+ * has the interface’s fields plus a ToX method per concrete
+ * type; ToX returns false unless the activity is an X.
+ */
+
+type ActivityResolver struct {
+	timestamp DateTime
+	user      *User
+	note      *Note // Only set for NoteCreated.
+}
+
+// ID is the ID of the note created or the user who joined:
+func (r *ActivityResolver) ID() graphql.ID {
+	if r.note != nil {
+		return r.note.NoteID
+	}
+	return r.user.UserID
+}
+
+func (r *ActivityResolver) Timestamp() DateTime {
+	return r.timestamp
+}
+
+func (r *ActivityResolver) ToNoteCreated() (*NoteCreatedResolver, bool) {
+	if r.note == nil {
+		return nil, false
+	}
+	return &NoteCreatedResolver{r}, true
+}
+
+func (r *ActivityResolver) ToUserJoined() (*UserJoinedResolver, bool) {
+	if r.note != nil {
+		return nil, false
+	}
+	return &UserJoinedResolver{r}, true
+}
+
+type NoteCreatedResolver struct{ *ActivityResolver }
+
+func (r *NoteCreatedResolver) Note() *NoteResolver {
+	return &NoteResolver{r.note}
+}
+
+type UserJoinedResolver struct{ *ActivityResolver }
+
+func (r *UserJoinedResolver) User() *UserResolver {
+	return &UserResolver{r.user}
+}
+
+/*
+ * PingResultResolver
+ */
+
+type PingResultResolver struct {
+	ok      bool
+	latency time.Duration
+}
+
+func (r *PingResultResolver) Ok() bool {
+	return r.ok
+}
+
+func (r *PingResultResolver) LatencyMs() float64 {
+	return float64(r.latency) / float64(time.Millisecond)
+}
+
+/*
+ * OperationsResolver
+ */
+
+type OperationsResolver struct{ ops *Operations }
+
+func (r *OperationsResolver) Queries() []string {
+	return r.ops.Queries
+}
+
+func (r *OperationsResolver) Mutations() []string {
+	return r.ops.Mutations
+}
+
+/*
+ * EchoOutputResolver
+ */
+
+type EchoOutputResolver struct{ in EchoInput }
+
+func (r *EchoOutputResolver) Text() string {
+	return r.in.Text
+}
+
+func (r *EchoOutputResolver) Number() int32 {
+	return r.in.Number
+}
+
+func (r *EchoOutputResolver) Flag() bool {
+	return r.in.Flag
+}
+
+func (r *EchoOutputResolver) Status() string {
+	return r.in.Status
+}
+
+func (r *EchoOutputResolver) Note() *string {
+	return r.in.Note
+}
+
+/*
+ * StatsResolver
+ */
+
+type StatsResolver struct{}
+
+func (r *StatsResolver) SchemaFieldCount() (int32, error) {
+	count, err := SchemaFieldCount(Schema)
+	return int32(count), err
+}
+
+/*
+ * Introspection
+ *
+ * GraphQL schemas describe themselves: the __schema field
+ * lists every type and its fields.
+ */
+
+// SchemaFieldCount runs an introspection query and counts
+// the fields across all object types, excluding the
+// introspection types themselves (__Schema, __Type, etc.)
+// and types graphql-go adds on its own (_Service).
+func SchemaFieldCount(s *graphql.Schema) (int, error) {
+	resp := s.Exec(context.Background(), `{
+		__schema {
+			types {
+				kind
+				name
+				fields {
+					name
+				}
+			}
+		}
+	}`, "", nil)
+	if len(resp.Errors) > 0 {
+		return 0, resp.Errors[0]
+	}
+	var data struct {
+		Schema struct {
+			Types []struct {
+				Kind   string
+				Name   string
+				Fields []struct{ Name string }
+			}
+		} `json:"__schema"`
+	}
+	err := json.Unmarshal(resp.Data, &data)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, t := range data.Schema.Types {
+		if t.Kind != "OBJECT" || strings.HasPrefix(t.Name, "_") {
+			continue
+		}
+		count += len(t.Fields)
+	}
+	return count, nil
+}
+
+// typeRef is an introspected type reference, e.g. [Note!]!
+// is NON_NULL of LIST of NON_NULL of Note:
+type typeRef struct {
+	Kind   string
+	Name   string
+	OfType *typeRef
+}
+
+func (t *typeRef) String() string {
+	switch t.Kind {
+	case "NON_NULL":
+		return t.OfType.String() + "!"
+	case "LIST":
+		return "[" + t.OfType.String() + "]"
+	default:
+		return t.Name
+	}
+}
+
+// complete reports whether the introspection query went deep
+// enough to reach the named type under the wrappers:
+func (t *typeRef) complete() bool {
+	for ; t != nil; t = t.OfType {
+		if t.Kind != "NON_NULL" && t.Kind != "LIST" {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateOperationAllowList introspects the schema and
+// returns the signature of every root query and mutation
+// field, sorted, e.g.:
+//
+//	mutation createNote(userID: ID!, note: NoteInput!, dryRun: Boolean = false): Note!
+//	query users(includeNotes: Boolean = false): [User!]!
+//
+// Ops can seed a persisted-query allowlist from these.
+//
+// Introspection can’t recurse, so TypeRef spells out seven
+// levels of ofType, as graphql-js’s introspection query does:
+// enough for [[[Note!]!]!]!. A type nested deeper is an error
+// rather than a wrong signature.
+func GenerateOperationAllowList(s *graphql.Schema) ([]string, error) {
+	resp := s.Exec(context.Background(), `
+		fragment TypeRef on __Type {
+			kind
+			name
+			ofType {
+				kind
+				name
+				ofType {
+					kind
+					name
+					ofType {
+						kind
+						name
+						ofType {
+							kind
+							name
+							ofType {
+								kind
+								name
+								ofType {
+									kind
+									name
+									ofType {
+										kind
+										name
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+		fragment RootType on __Type {
+			fields {
+				name
+				args {
+					name
+					type {
+						...TypeRef
+					}
+					defaultValue
+				}
+				type {
+					...TypeRef
+				}
+			}
+		}
+		{
+			__schema {
+				queryType {
+					...RootType
+				}
+				mutationType {
+					...RootType
+				}
+			}
+		}
+	`, "", nil)
+	if len(resp.Errors) > 0 {
+		return nil, resp.Errors[0]
+	}
+	type rootType struct {
+		Fields []struct {
+			Name string
+			Args []struct {
+				Name         string
+				Type         *typeRef
+				DefaultValue *string
+			}
+			Type *typeRef
+		}
+	}
+	var data struct {
+		Schema struct {
+			QueryType    *rootType
+			MutationType *rootType
+		} `json:"__schema"`
+	}
+	err := json.Unmarshal(resp.Data, &data)
+	if err != nil {
+		return nil, err
+	}
+	var allowList []string
+	for op, root := range map[string]*rootType{
+		"query":    data.Schema.QueryType,
+		"mutation": data.Schema.MutationType,
+	} {
+		if root == nil {
+			continue
+		}
+		for _, field := range root.Fields {
+			if !field.Type.complete() {
+				return nil, fmt.Errorf("%s: type nested too deeply to introspect", field.Name)
+			}
+			var args []string
+			for _, arg := range field.Args {
+				if !arg.Type.complete() {
+					return nil, fmt.Errorf("%s(%s): type nested too deeply to introspect", field.Name, arg.Name)
+				}
+				sig := arg.Name + ": " + arg.Type.String()
+				if arg.DefaultValue != nil {
+					sig += " = " + *arg.DefaultValue
+				}
+				args = append(args, sig)
+			}
+			sig := op + " " + field.Name
+			if len(args) > 0 {
+				sig += "(" + strings.Join(args, ", ") + ")"
+			}
+			allowList = append(allowList, sig+": "+field.Type.String())
+		}
+	}
+	sort.Strings(allowList)
+	return allowList, nil
+}
+
+/*
+ * Validation
+ */
+
+// ValidationError describes bad input. graphql-go copies
+// Extensions into the response, so clients can tell
+// validation errors apart from other failures by their
+// "VALIDATION" code.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func (e *ValidationError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":  "VALIDATION",
+		"field": e.Field,
+	}
+}
+
+// ConflictError means the client’s copy of a note is stale.
+type ConflictError struct {
+	Current  int32
+	Expected int32
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("stale version: note is at version %d, not %d; refetch and try again", e.Current, e.Expected)
+}
+
+func (e *ConflictError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":    "CONFLICT",
+		"version": e.Current,
+	}
+}
+
+// A flag emoji is a pair of regional indicator symbols,
+// e.g. 🇵🇹 is U+1F1F5 U+1F1F9 (P, T).
+func isRegionalIndicator(r rune) bool {
+	return r >= '\U0001F1E6' && r <= '\U0001F1FF'
+}
+
+// FlagRegions are the regions with a flag emoji: the ISO
+// 3166-1 country codes, plus a few regions Unicode also has
+// flags for, e.g. EU and UN. Any other pair of regional
+// indicators, e.g. 🇦🇦, shows up as two letters, not a flag.
+var FlagRegions = map[string]bool{}
+
+func init() {
+	for _, region := range strings.Fields(`
+	AC AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB
+	BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ
+	CA CC CD CF CG CH CI CK CL CM CN CO CP CQ CR CU CV CW CX
+	CY CZ DE DG DJ DK DM DO DZ EA EC EE EG EH ER ES ET EU FI
+	FJ FK FM FO FR GA GB GD GE GF GG GH GI GL GM GN GP GQ GR
+	GS GT GU GW GY HK HM HN HR HT HU IC ID IE IL IM IN IO IQ
+	IR IS IT JE JM JO JP KE KG KH KI KM KN KP KR KW KY KZ LA
+	LB LC LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML
+	MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ NA NC NE NF NG
+	NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS
+	PT PW PY QA RE RO RS RU RW SA SB SC SD SE SG SH SI SJ SK
+	SL SM SN SO SR SS ST SV SX SY SZ TA TC TD TF TG TH TJ TK
+	TL TM TN TO TR TT TV TW TZ UA UG UM UN US UY UZ VA VC VE
+	VG VI VN VU WF WS YE YT ZA ZM ZW
+	`) {
+		FlagRegions[region] = true
+	}
+}
+
+// normalizeEmoji returns the canonical form of a flag emoji:
+// exactly one regional indicator pair for a region in
+// FlagRegions. Surrounding space and variation selectors are
+// dropped. Anything else is rejected: a lone regional
+// indicator (half a flag), a pair that isn’t a flag, another
+// emoji, or letters like "pt" — the field takes the flag
+// itself.
+func normalizeEmoji(emoji string) (string, error) {
+	var runes []rune
+	for _, r := range strings.TrimSpace(emoji) {
+		if unicode.Is(unicode.Variation_Selector, r) {
+			continue
+		}
+		runes = append(runes, r)
+	}
+	if len(runes) != 2 || !isRegionalIndicator(runes[0]) || !isRegionalIndicator(runes[1]) {
+		return "", &ValidationError{Field: "emoji", Message: "must be a single flag"}
+	}
+	region := string([]rune{'A' + runes[0] - '\U0001F1E6', 'A' + runes[1] - '\U0001F1E6'})
+	if !FlagRegions[region] {
+		return "", &ValidationError{Field: "emoji", Message: "must be a single flag"}
+	}
+	return string(runes), nil
+}
+
+// Blocklist maps a category to words notes may not contain.
+// Matching is case-insensitive and by whole word, so "Casino"
+// is blocked but "occasional" isn’t.
+var Blocklist = map[string][]string{
+	"profanity": {"darn", "heck"},
+	"spam":      {"casino", "viagra"},
+}
+
+// checkUTF8 rejects invalid UTF-8, which Postgres would
+// reject anyway but with an opaque driver error. JSON decoding
+// already replaces invalid bytes with U+FFFD, so this guards
+// callers that don’t come through JSON, e.g. Exec from Go.
+func checkUTF8(field, s string) error {
+	if !utf8.ValidString(s) {
+		return &ValidationError{Field: field, Message: "must be valid UTF-8"}
+	}
+	return nil
+}
+
+// checkBlocklist rejects data containing a blocked word. The
+// error names the category, not the word, so it doesn’t echo
+// the word back. With words from several categories, it names
+// the first word’s, checking categories in sorted order, so
+// the same data always gets the same error.
+func checkBlocklist(data string) error {
+	var categories []string
+	for category := range Blocklist {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	words := strings.FieldsFunc(strings.ToLower(data), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		for _, category := range categories {
+			for _, b := range Blocklist[category] {
+				if word == b {
+					return &ValidationError{Field: "data", Message: "contains blocked words (" + category + ")"}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * Localized errors
+ *
+ * The notes are in Portuguese, Ukrainian, and English, so
+ * are our error messages. The HTTP handler reads the
+ * client’s Accept-Language header into the context.
+ */
+
+const (
+	CodeUserNotFound = "USER_NOT_FOUND"
+	CodeNoteNotFound = "NOTE_NOT_FOUND"
+)
+
+// ErrorMessages maps error codes to messages per locale:
+var ErrorMessages = map[string]map[string]string{
+	CodeUserNotFound: {
+		"EN": "user not found",
+		"PT": "utilizador não encontrado",
+		"UK": "користувача не знайдено",
+	},
+	CodeNoteNotFound: {
+		"EN": "note not found",
+		"PT": "nota não encontrada",
+		"UK": "нотатку не знайдено",
+	},
+}
+
+type localeKey struct{}
+
+func withLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// localeFor picks the supported language the client prefers
+// most from an Accept-Language header like
+// "pt-PT,pt;q=0.9,en;q=0.8", defaulting to EN. Each language
+// has a weight, q, from 0 to 1 (1 if omitted); q=0 means “not
+// this one”, and ties go to the language listed first.
+func localeFor(r *http.Request) string {
+	locale, best := "EN", 0.0
+	for _, tag := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		parts := strings.Split(tag, ";")
+		lang := strings.TrimSpace(parts[0])
+		lang = strings.ToUpper(strings.SplitN(lang, "-", 2)[0])
+		q := 1.0
+		for _, param := range parts[1:] {
+			value, ok := strings.CutPrefix(strings.TrimSpace(param), "q=")
+			if !ok {
+				continue
+			}
+			var err error
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				q = 0
+			}
+		}
+		switch lang {
+		case "EN", "PT", "UK":
+			if q > best {
+				locale, best = lang, q
+			}
+		}
+	}
+	return locale
+}
+
+// LocalizedError keeps its code in the extensions so clients
+// can handle it regardless of language:
+type LocalizedError struct {
+	Code    string
+	Message string
+}
+
+func (e *LocalizedError) Error() string {
+	return e.Message
+}
+
+func (e *LocalizedError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.Code}
+}
+
+func localizedError(ctx context.Context, code string) error {
+	locale, _ := ctx.Value(localeKey{}).(string)
+	message, ok := ErrorMessages[code][locale]
+	if !ok {
+		message = ErrorMessages[code]["EN"]
+	}
+	return &LocalizedError{Code: code, Message: message}
+}
+
+/*
+ * Error detail
+ *
+ * Errors meant for clients — those with extensions, e.g.
+ * ValidationError, and the sentinels in PublicErrors — are
+ * returned as is. Anything else, e.g. a Postgres error, is
+ * logged in full and, unless DebugErrors is set, replaced by
+ * “internal error” so we don’t leak SQL or schema details.
+ * With DebugErrors (DEBUG_ERRORS=true), clients see the full
+ * message and, for Postgres errors, the SQLSTATE.
+ */
+
+var DebugErrors = false
+
+var PublicErrors = []error{
+	ErrForbidden,
+	ErrReseedDisabled,
+	ErrExportDisabled,
+	ErrIdempotentReplay,
+	ErrIdempotencyKeyMismatch,
+	ErrServiceUnavailable,
+	context.Canceled,
+	context.DeadlineExceeded,
+}
+
+func isPublic(err error) bool {
+	var withExtensions interface{ Extensions() map[string]interface{} }
+	if errors.As(err, &withExtensions) {
+		return true
+	}
+	for _, public := range PublicErrors {
+		if errors.Is(err, public) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeErrors applies the rules above to resp.Errors. It
+// leaves ResolverError alone, so callers can still inspect
+// the original error:
+func sanitizeErrors(resp *graphql.Response) {
+	for _, err := range resp.Errors {
+		if err.ResolverError == nil || isPublic(err.ResolverError) {
+			continue
+		}
+		log.Printf("resolver error at %v: %s", err.Path, err.ResolverError)
+		if !DebugErrors {
+			err.Message = "internal error"
+			err.Extensions = map[string]interface{}{"code": "INTERNAL"}
+			continue
+		}
+		var pqErr *pq.Error
+		if errors.As(err.ResolverError, &pqErr) {
+			if err.Extensions == nil {
+				err.Extensions = map[string]interface{}{}
+			}
+			err.Extensions["sqlState"] = string(pqErr.Code)
+		}
+	}
+}
+
+/*
+ * Roles
+ *
+ * Requests are made as a USER unless they present the admin
+ * API key (see handleGraphQL). Resolvers read the role from
+ * the context.
+ */
+
+const (
+	RoleUser  = "USER"
+	RoleAdmin = "ADMIN"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+// Context keys are unexported types so they can’t collide
+// with other packages’ keys:
+type roleKey struct{}
+
+func withRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleKey{}, role)
+}
+
+func requireAdmin(ctx context.Context) error {
+	role, _ := ctx.Value(roleKey{}).(string)
+	if role != RoleAdmin {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// FieldRoles maps fields, e.g. "Query.allNotes", to the role
+// their @auth(requires: ...) directive requires. main loads
+// it from the schema, so the schema is the one place access
+// is declared.
+var FieldRoles = map[string]string{}
+
+func loadFieldRoles(s *graphql.Schema) map[string]string {
+	fieldRoles := map[string]string{}
+	for typeName, t := range s.ASTSchema().Types {
+		object, ok := t.(*types.ObjectTypeDefinition)
+		if !ok {
+			continue
+		}
+		for _, field := range object.Fields {
+			auth := field.Directives.Get("auth")
+			if auth == nil {
+				continue
+			}
+			requires, ok := auth.Arguments.Get("requires")
+			if ok {
+				fieldRoles[typeName+"."+field.Name] = requires.String()
+			}
+		}
+	}
+	return fieldRoles
+}
+
+// authorize checks the caller’s role against the field’s
+// @auth directive; admins can do anything users can.
+// graphql-go has no hook that runs before a resolver, so the
+// resolvers of annotated fields call authorize first. When
+// it fails, the field resolves to null with an error and the
+// rest of the query resolves as usual.
+//
+// Only annotated fields call authorize, so a field missing
+// from FieldRoles means a typo or roles that were never
+// loaded. We deny it rather than serve it to everyone.
+func authorize(ctx context.Context, field string) error {
+	required, ok := FieldRoles[field]
+	if !ok {
+		return fmt.Errorf("%w: %s has no @auth role", ErrForbidden, field)
+	}
+	role, _ := ctx.Value(roleKey{}).(string)
+	if role == "" {
+		role = RoleUser
+	}
+	if role == required || role == RoleAdmin {
+		return nil
+	}
+	return fmt.Errorf("%w: %s requires %s", ErrForbidden, field, required)
+}
+
+// roleFor returns ADMIN when the request carries
+// “Authorization: Bearer $ADMIN_API_KEY”:
+func roleFor(r *http.Request) string {
+	apiKey := os.Getenv("ADMIN_API_KEY")
+	if apiKey == "" {
+		return RoleUser
+	}
+	auth := r.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+apiKey)) == 1 {
+		return RoleAdmin
+	}
+	return RoleUser
+}
+
+/*
+ * Disabled mutations
+ *
+ * During maintenance we can make the API read-only by listing
+ * mutations in DISABLED_MUTATIONS, e.g.:
+ *
+ * $ DISABLED_MUTATIONS=createNote,deleteUser go run main-6.go
+ *
+ * The mutations stay in the schema, so introspection still
+ * shows them; calling one fails with “operation disabled”
+ * and a 400 over HTTP. Bulk imports write too, so
+ * importNotes can be disabled the same way.
+ */
+
+var DisabledMutations = map[string]bool{}
+
+// loadDisabledMutations parses a comma-separated list of
+// mutation names:
+func loadDisabledMutations(list string) map[string]bool {
+	disabled := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			disabled[name] = true
+		}
+	}
+	return disabled
+}
+
+type DisabledError struct{ Mutation string }
+
+func (e *DisabledError) Error() string {
+	return fmt.Sprintf("operation disabled: %s is temporarily unavailable", e.Mutation)
+}
+
+func (e *DisabledError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": "OPERATION_DISABLED"}
+}
+
+func requireEnabled(mutation string) error {
+	if DisabledMutations[mutation] {
+		return &DisabledError{Mutation: mutation}
+	}
+	return nil
+}
+
+/*
+ * Circuit breaker
+ *
+ * When Postgres goes away, every request waits on a dead
+ * connection and fails one at a time. A circuit breaker
+ * counts consecutive failures and, past a threshold, fails
+ * fast for a cooldown window instead of hammering the
+ * database. After the cooldown, the next request is let
+ * through as a trial: success closes the breaker again and
+ * failure reopens it.
+ */
+
+var ErrServiceUnavailable = errors.New("service temporarily unavailable")
+
+type Breaker struct {
+	Threshold int           // Consecutive failures before opening.
+	Cooldown  time.Duration // How long to fail fast once open.
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+var DBBreaker = &Breaker{Threshold: 5, Cooldown: 10 * time.Second}
+
+// Allow returns ErrServiceUnavailable while the breaker is
+// open:
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.Threshold && time.Since(b.openedAt) < b.Cooldown {
+		return ErrServiceUnavailable
+	}
+	return nil
+}
+
+// Record counts a failure or, on success, resets the breaker:
+func (b *Breaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.Threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// isUnavailable reports whether err means we couldn’t reach
+// Postgres, as opposed to e.g. a bad query or a missing row.
+// A cancelled or timed-out request isn’t Postgres’s fault, so
+// we rule out context errors first: context.DeadlineExceeded
+// is a net.Error too.
+func isUnavailable(err error) bool {
+	var netErr net.Error
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, driver.ErrBadConn):
+		return true
+	case errors.As(err, &netErr):
+		return true
+	case errors.As(err, &pqErr):
+		// 08: connection exception, 57: operator intervention,
+		// except 57014, a query cancelled by a timeout.
+		if pqErr.Code == "57014" {
+			return false
+		}
+		return pqErr.Code.Class() == "08" || pqErr.Code.Class() == "57"
+	}
+	return false
+}
+
+/*
+ * Memoization
+ *
+ * One query can ask for the same notes more than once, e.g.
+ * { users { notes } user(userID: "u-33e723") { notes } }.
+ * Exec stores a memo in each request’s context so identical
+ * reads hit the database once. The memo lives and dies with
+ * the request, so it never serves notes from before a write
+ * in an earlier request.
+ */
+
+type memoKey struct{}
+
+type memoEntry struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+type memo struct {
+	mu      sync.Mutex
+	entries map[string]*memoEntry
+}
+
+func withMemo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, memoKey{}, &memo{entries: map[string]*memoEntry{}})
+}
+
+// memoize calls fn once per key per request; resolvers run
+// concurrently, so concurrent callers wait for the first.
+// Without a memo in the context, fn is called every time.
+func memoize(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	m, ok := ctx.Value(memoKey{}).(*memo)
+	if !ok {
+		return fn()
+	}
+	m.mu.Lock()
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &memoEntry{}
+		m.entries[key] = entry
+	}
+	m.mu.Unlock()
+	entry.once.Do(func() {
+		entry.value, entry.err = fn()
+	})
+	return entry.value, entry.err
+}
+
+// memoNotes is queryNotes against ReadDB, memoized by its
+// arguments:
+func memoNotes(ctx context.Context, userID graphql.ID, limit *int32) ([]*NoteResolver, error) {
+	key := fmt.Sprintf("queryNotes(%s, all)", userID)
+	if limit != nil {
+		key = fmt.Sprintf("queryNotes(%s, %d)", userID, *limit)
+	}
+	value, err := memoize(ctx, key, func() (interface{}, error) {
+		return queryNotes(ctx, ReadDB(), userID, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]*NoteResolver), nil
+}
+
+/*
+ * Tag loader
+ *
+ * { notes(userID: ...) { tags } } would query note_tags once
+ * per note. Waiting a moment for the other notes’ resolvers
+ * isn’t enough: graphql-go runs at most MaxParallelism (10)
+ * of them at a time, so N notes still take about N/10 queries.
+ *
+ * Instead, resolvers that return a list of notes prime the
+ * request’s tagLoader with the notes’ IDs (see primeTags).
+ * The first NoteResolver.Tags call for a primed note loads the
+ * tags of every primed note in one query, and the rest wait on
+ * it. Notes nobody primed — say, from note(noteID: ...) — fall
+ * back to a batch that collects IDs for TagBatchWait.
+ */
+
+// TagBatchWait is how long a batch of unprimed notes collects
+// note IDs:
+var TagBatchWait = 2 * time.Millisecond
+
+type tagLoaderKey struct{}
+
+type tagBatch struct {
+	noteIDs []graphql.ID
+	done    chan struct{}
+	tags    map[graphql.ID][]string
+	err     error
+}
+
+type tagLoader struct {
+	mu      sync.Mutex
+	primed  map[graphql.ID]bool      // Primed IDs not loaded yet.
+	batches map[graphql.ID]*tagBatch // Each ID’s batch, once asked about.
+	batch   *tagBatch                // The batch collecting unprimed IDs, if any.
+}
+
+func withTagLoader(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tagLoaderKey{}, &tagLoader{
+		primed:  map[graphql.ID]bool{},
+		batches: map[graphql.ID]*tagBatch{},
+	})
+}
+
+// primeTags tells the request’s tag loader that the notes’
+// tags may be asked for. It doesn’t query anything: if no one
+// asks, no one pays.
+func primeTags(ctx context.Context, noteRxs ...*NoteResolver) {
+	l, ok := ctx.Value(tagLoaderKey{}).(*tagLoader)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, noteRx := range noteRxs {
+		if _, ok := l.batches[noteRx.n.NoteID]; !ok {
+			l.primed[noteRx.n.NoteID] = true
+		}
+	}
+}
+
+// loadTags returns the note’s tags, loaded with the other
+// primed notes’ tags, or batched with the other unprimed notes
+// asked about at about the same time. Without a loader in the
+// context, it loads just this note’s tags.
+func loadTags(ctx context.Context, noteID graphql.ID) ([]string, error) {
+	l, ok := ctx.Value(tagLoaderKey{}).(*tagLoader)
+	if !ok {
+		tags, err := queryTags(ctx, []graphql.ID{noteID})
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{}, tags[noteID]...), nil
+	}
+	l.mu.Lock()
+	batch, ok := l.batches[noteID]
+	switch {
+	case ok:
+		// Someone is already loading this note’s tags.
+		l.mu.Unlock()
+	case l.primed[noteID]:
+		// Load every primed note’s tags now, in this resolver:
+		batch = &tagBatch{done: make(chan struct{})}
+		for primedID := range l.primed {
+			batch.noteIDs = append(batch.noteIDs, primedID)
+			l.batches[primedID] = batch
+		}
+		l.primed = map[graphql.ID]bool{}
+		l.mu.Unlock()
+		batch.tags, batch.err = queryTags(ctx, batch.noteIDs)
+		close(batch.done)
+	default:
+		batch = l.batch
+		if batch == nil {
+			batch = &tagBatch{done: make(chan struct{})}
+			l.batch = batch
+			go func() {
+				time.Sleep(TagBatchWait)
+				// Later calls start a new batch:
+				l.mu.Lock()
+				l.batch = nil
+				l.mu.Unlock()
+				batch.tags, batch.err = queryTags(ctx, batch.noteIDs)
+				close(batch.done)
+			}()
+		}
+		batch.noteIDs = append(batch.noteIDs, noteID)
+		l.batches[noteID] = batch
+		l.mu.Unlock()
+	}
+	<-batch.done
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	return append([]string{}, batch.tags[noteID]...), nil
+}
+
+// queryTags loads the tags of the notes, grouped by note:
+func queryTags(ctx context.Context, noteIDs []graphql.ID) (map[graphql.ID][]string, error) {
+	ids := make([]string, 0, len(noteIDs))
+	for _, noteID := range noteIDs {
+		ids = append(ids, string(noteID))
+	}
+	var rows *sql.Rows
+	err := timeQuery(ctx, "queryTags", func() (err error) {
+		rows, err = ReadDB().QueryContext(ctx, `
+			SELECT
+				note_id,
+				tag
+			FROM note_tags
+			WHERE note_id = ANY($1)
+			ORDER BY note_id, tag
+		`, pq.Array(ids))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := map[graphql.ID][]string{}
+	for rows.Next() {
+		var (
+			noteID graphql.ID
+			tag    string
+		)
+		err := rows.Scan(&noteID, &tag)
+		if err != nil {
+			return nil, err
+		}
+		tags[noteID] = append(tags[noteID], tag)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+/*
+ * Result size cap
+ *
+ * Clients choose how many notes they want with limit and
+ * first, so nothing stops them asking for a million. We
+ * clamp the requested size to MaxResults and, rather than
+ * fail, say so in the response’s extensions:
+ *
+ * "extensions": {
+ * 	"warnings": [
+ * 		"limit: clamped 5000 to 1000 results"
+ * 	]
+ * }
+ *
+ * Lists without a size argument, e.g. users or a user’s
+ * notes, stop at MaxResults too, with a “truncated” warning.
+ */
+
+// MaxResults is the most rows a list resolver returns:
+var MaxResults int32 = 1000
+
+type warningsKey struct{}
+
+type warnings struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func withWarnings(ctx context.Context) (context.Context, *warnings) {
+	w := &warnings{}
+	return context.WithValue(ctx, warningsKey{}, w), w
+}
+
+func addWarning(ctx context.Context, warning string) {
+	w, ok := ctx.Value(warningsKey{}).(*warnings)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.list = append(w.list, warning)
+}
+
+// clampLimit is the one place list sizes are clamped: a nil
+// request means def, and anything else is clamped to
+// [0, max]. Resolvers that reject bad sizes, e.g. a negative
+// limit, do so before clamping.
+func clampLimit(requested *int32, def, max int32) int32 {
+	n := def
+	if requested != nil {
+		n = *requested
+	}
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// clampResults clamps the requested size with clampLimit and
+// warns the client when it had to:
+func clampResults(ctx context.Context, field string, requested *int32, def, max int32) int32 {
+	limit := clampLimit(requested, def, max)
+	if requested != nil && limit < *requested {
+		addWarning(ctx, fmt.Sprintf("%s: clamped %d to %d results", field, *requested, limit))
+	}
+	return limit
+}
+
+// capResults is for lists without a size argument, e.g.
+// users: they fetch n rows with LIMIT MaxResults+1, and
+// capResults returns how many to keep, MaxResults at most,
+// warning the client when there were more:
+func capResults(ctx context.Context, field string, n int) int {
+	if n <= int(MaxResults) {
+		return n
+	}
+	addWarning(ctx, fmt.Sprintf("%s: truncated to %d results", field, MaxResults))
+	return int(MaxResults)
+}
+
+/*
+ * Pruning
+ *
+ * Archived notes are kept for a while in case they’re
+ * unarchived, then deleted by a background worker.
+ */
+
+var (
+	pruneInterval  = flag.Duration("prune-interval", time.Hour, "how often to prune archived notes")
+	pruneRetention = flag.Duration("prune-retention", 30*24*time.Hour, "how long to keep archived notes")
+)
+
+// pruneArchivedNotes deletes notes archived longer than
+// retention ago and returns how many it deleted. It goes by
+// archived_at, not updated_at, so editing an archived note
+// doesn’t put off its pruning (see main-6-schema.sql):
+func pruneArchivedNotes(ctx context.Context, retention time.Duration) (int64, error) {
+	var res sql.Result
+	err := timeQuery(ctx, "pruneArchivedNotes", func() (err error) {
+		res, err = DB.ExecContext(ctx, `
+			DELETE FROM notes
+			WHERE status = 'ARCHIVED' AND archived_at < now() - make_interval(secs => $1)
+		`, retention.Seconds())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// runPruner prunes every interval until ctx is cancelled:
+func runPruner(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := pruneArchivedNotes(ctx, retention)
+			if err != nil {
+				log.Printf("pruneArchivedNotes: %s", err)
+				continue
+			}
+			log.Printf("Pruned %d archived notes", pruned)
+		}
+	}
+}
+
+/*
+ * Connection pool
+ *
+ * database/sql keeps a pool of connections. Idle connections
+ * are closed after -db-max-idle-time, so a burst of traffic
+ * doesn’t hold connections open forever. To diagnose leaks —
+ * e.g. rows that are never closed — set -pool-stats-interval
+ * and watch for in-use connections that never return to idle.
+ */
+
+var (
+	dbMaxIdleTime     = flag.Duration("db-max-idle-time", 5*time.Minute, "close connections idle this long")
+	poolStatsInterval = flag.Duration("pool-stats-interval", 0, "how often to log pool stats (0 disables)")
+)
+
+// logPoolStats logs DB.Stats() every interval until ctx is
+// cancelled:
+func logPoolStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := DB.Stats()
+			log.Printf(
+				"DB.Stats: open=%d in_use=%d idle=%d wait_count=%d wait_duration=%s max_idle_time_closed=%d",
+				stats.OpenConnections, stats.InUse, stats.Idle,
+				stats.WaitCount, stats.WaitDuration, stats.MaxIdleTimeClosed,
+			)
+		}
+	}
+}
+
+/*
+ * Slow queries
+ *
+ * Every query runs through timeQuery, which logs a warning
+ * when it takes longer than -slow-query. The label names the
+ * resolver, so a regression points straight at its SQL.
+ *
+ * Since it sees every query, timeQuery also tells the circuit
+ * breaker how they went. Requests that never touch Postgres
+ * don’t count, and neither do requests cancelled by their
+ * client.
+ */
+
+var slowQuery = flag.Duration("slow-query", 100*time.Millisecond, "log queries slower than this")
+
+func timeQuery(ctx context.Context, label string, fn func() error) error {
+	countDBQuery(ctx)
+	start := time.Now()
+	err := fn()
+	if elapsed := time.Since(start); elapsed > *slowQuery {
+		log.Printf("WARNING: slow query %s took %s", label, elapsed)
+	}
+	if ctx.Err() == nil {
+		DBBreaker.Record(isUnavailable(err))
+	}
+	return err
+}
+
+/*
+ * Execution stats
+ *
+ * Exec counts the fields it resolves and the queries it runs
+ * and adds them to the response, so an N+1 shows up as a
+ * dbQueries count that grows with the result:
+ *
+ * "extensions": {
+ * 	"stats": {
+ * 		"resolverCalls": 12,
+ * 		"dbQueries": 3
+ * 	}
+ * }
+ *
+ * Queries are counted by timeQuery, so a transaction counts
+ * as one query (see runInTx).
+ */
+
+type statsKey struct{}
+
+type execStats struct {
+	mu            sync.Mutex
+	resolverCalls int
+	dbQueries     int
+}
+
+func withStats(ctx context.Context) (context.Context, *execStats) {
+	s := &execStats{}
+	return context.WithValue(ctx, statsKey{}, s), s
+}
+
+func countResolverCall(ctx context.Context) {
+	s, ok := ctx.Value(statsKey{}).(*execStats)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolverCalls++
+}
+
+func countDBQuery(ctx context.Context) {
+	s, ok := ctx.Value(statsKey{}).(*execStats)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dbQueries++
+}
+
+func (s *execStats) JSON() JSON {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return JSON{"resolverCalls": s.resolverCalls, "dbQueries": s.dbQueries}
+}
+
+// statsTracer counts resolver calls. graphql-go traces every
+// field it resolves, including trivial ones like username:
+type statsTracer struct{}
+
+func (statsTracer) TraceQuery(ctx context.Context, queryString string, operationName string, variables map[string]interface{}, varTypes map[string]*introspection.Type) (context.Context, func([]*gqlerrors.QueryError)) {
+	return ctx, func([]*gqlerrors.QueryError) {}
+}
+
+func (statsTracer) TraceField(ctx context.Context, label, typeName, fieldName string, trivial bool, args map[string]interface{}) (context.Context, func(*gqlerrors.QueryError)) {
+	countResolverCall(ctx)
+	return ctx, func(*gqlerrors.QueryError) {}
+}
+
+/*
+ * Subscriptions
+ *
+ * The broker fans out new notes to subscribers in this
+ * process. Each subscription gets an ID and a cancel function;
+ * cancelling its context closes its channel, so clients on
+ * transports that can’t close a channel can unsubscribe by
+ * ID instead. The ID is all unsubscribe asks for, so it’s
+ * random rather than a counter anyone could guess.
+ */
+
+type subscriber struct {
+	userID *graphql.ID // nil means every user.
+	notes  chan *Note
+	cancel context.CancelFunc
+}
+
+type Broker struct {
+	mu   sync.Mutex
+	subs map[graphql.ID]*subscriber
+}
+
+var broker = &Broker{subs: map[graphql.ID]*subscriber{}}
+
+// Subscribe registers a subscriber until ctx is cancelled or
+// it unsubscribes. A subscriber that falls behind misses
+// notes rather than blocking Publish:
+func (b *Broker) Subscribe(ctx context.Context, userID *graphql.ID) <-chan *NoteEventResolver {
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &subscriber{userID: userID, notes: make(chan *Note, 16), cancel: cancel}
+	id := newSubscriptionID()
+	b.mu.Lock()
+	b.subs[id] = sub
+	b.mu.Unlock()
+
+	events := make(chan *NoteEventResolver)
+	go func() {
+		defer close(events)
+		defer b.Unsubscribe(id)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case note := <-sub.notes:
+				select {
+				case events <- &NoteEventResolver{id, note}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// newSubscriptionID returns "s-" and 32 random hex digits:
+func newSubscriptionID() graphql.ID {
+	bstr := make([]byte, 16)
+	_, err := rand.Read(bstr)
+	if err != nil {
+		panic(err)
+	}
+	return graphql.ID("s-" + hex.EncodeToString(bstr))
+}
+
+func (b *Broker) Publish(userID graphql.ID, note *Note) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sub := range b.subs {
+		if sub.userID != nil && *sub.userID != userID {
+			continue
+		}
+		select {
+		case sub.notes <- note:
+		default:
+		}
+	}
+}
+
+// Unsubscribe cancels a subscription; it reports false for
+// unknown (or already cancelled) IDs.
+func (b *Broker) Unsubscribe(id graphql.ID) bool {
+	b.mu.Lock()
+	sub, ok := b.subs[id]
+	delete(b.subs, id)
+	b.mu.Unlock()
+	if ok {
+		sub.cancel()
+	}
+	return ok
+}
+
+type SubscriptionResolver struct{}
+
+// NoteCreated streams new notes, optionally for one user.
+// Each event carries the subscription’s ID for unsubscribe:
+func (r *SubscriptionResolver) NoteCreated(ctx context.Context, args struct{ UserID *graphql.ID }) <-chan *NoteEventResolver {
+	return broker.Subscribe(ctx, args.UserID)
+}
+
+func (r *MutationResolver) Unsubscribe(args struct{ SubscriptionID graphql.ID }) bool {
+	return broker.Unsubscribe(args.SubscriptionID)
+}
+
+type NoteEventResolver struct {
+	subscriptionID graphql.ID
+	n              *Note
+}
+
+func (r *NoteEventResolver) SubscriptionID() graphql.ID {
+	return r.subscriptionID
+}
+
+func (r *NoteEventResolver) Note() *NoteResolver {
+	return &NoteResolver{r.n}
+}
+
+/*
+ * Responders (see main-7)
+ */
+
+const (
+	StatusCodeOK                 = 200
+	StatusCodeBadRequest         = 400
+	StatusCodeForbidden          = 403
+	StatusCodeNotFound           = 404
+	StatusCodeConflict           = 409
+	StatusCodeUnprocessable      = 422
+	StatusCodeServerError        = 500
+	StatusCodeServiceUnavailable = 503
+)
+
+var Statuses = map[int]string{
+	StatusCodeOK:                 "OK",
+	StatusCodeBadRequest:         "Bad Request",
+	StatusCodeForbidden:          "Forbidden",
+	StatusCodeNotFound:           "Not Found",
+	StatusCodeConflict:           "Conflict",
+	StatusCodeUnprocessable:      "Unprocessable Entity",
+	StatusCodeServerError:        "Server Error",
+	StatusCodeServiceUnavailable: "Service Unavailable",
+}
+
+var (
+	RespondOK                 = NewResponder(StatusCodeOK)
+	RespondBadRequest         = NewResponder(StatusCodeBadRequest)
+	RespondForbidden          = NewResponder(StatusCodeForbidden)
+	RespondNotFound           = NewResponder(StatusCodeNotFound)
+	RespondConflict           = NewResponder(StatusCodeConflict)
+	RespondUnprocessable      = NewResponder(StatusCodeUnprocessable)
+	RespondServerError        = NewResponder(StatusCodeServerError)
+	RespondServiceUnavailable = NewResponder(StatusCodeServiceUnavailable)
+)
+
+func NewResponder(statusCode int) func(http.ResponseWriter) {
+	respond := func(w http.ResponseWriter) {
+		if statusCode >= 200 && statusCode <= 299 {
+			w.WriteHeader(statusCode)
+			return
+		}
+		status := Statuses[statusCode]
+		http.Error(w, status, statusCode)
+	}
+	return respond
+}
+
+/*
+ * main
+ */
+
+// DB is the primary: mutations write to it. Reads that
+// don’t need to see a write from the same request (Users,
+// User, Notes, and Note) go to ReadDB instead, so a read
+// replica can take that load. Replicas lag a little behind
+// the primary.
+var (
+	DB        *sql.DB
+	ReplicaDB *sql.DB
+)
+
+// ReadDB returns the replica, or the primary when there’s no
+// replica:
+func ReadDB() *sql.DB {
+	if ReplicaDB != nil {
+		return ReplicaDB
+	}
+	return DB
+}
+
+var Schema *graphql.Schema
+
+type JSON = map[string]interface{}
+
+type ClientQuery struct {
+	OpName    string `json:"operationName"`
+	Query     string `json:"query"`
+	Variables JSON   `json:"variables"`
+}
+
+// Exec fails fast while the circuit breaker is open (see
+// timeQuery for how it opens):
+func Exec(ctx context.Context, q ClientQuery) *graphql.Response {
+	err := DBBreaker.Allow()
+	if err != nil {
+		return &graphql.Response{
+			Errors: []*gqlerrors.QueryError{{Message: err.Error(), ResolverError: err}},
+		}
+	}
+	ctx, warnings := withWarnings(withTagLoader(withMemo(ctx)))
+	ctx, stats := withStats(ctx)
+	resp := Schema.Exec(ctx, q.Query, q.OpName, q.Variables)
+	sanitizeErrors(resp)
+	resp.Extensions = map[string]interface{}{"stats": stats.JSON()}
+	if len(warnings.list) > 0 {
+		resp.Extensions["warnings"] = warnings.list
+	}
+	return resp
+}
+
+// The examples in main also run over HTTP when we pass an
+// address, e.g.:
+//
+// $ go run main-6.go -addr :8000
+// $ curl -d '{"query": "{ users { username } }"}' localhost:8000/graphql
+var addr = flag.String("addr", "", "serve /graphql on this address")
+
+// Print the operation allowlist (see GenerateOperationAllowList)
+// instead of running the examples:
+var printAllowList = flag.Bool("allowlist", false, "print the operation allowlist and exit")
+
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RespondNotFound(w)
+		return
+	}
+	var q ClientQuery
+	err := json.NewDecoder(r.Body).Decode(&q)
+	if err != nil {
+		RespondBadRequest(w)
+		log.Printf("json.Decode: %s", err)
+		return
+	}
+	ctx := withRole(r.Context(), roleFor(r))
+	ctx = withLocale(ctx, localeFor(r))
+	var claim *idempotencyClaim
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		hash, err := requestHash(q)
+		if err != nil {
+			RespondBadRequest(w)
+			log.Printf("requestHash: %s", err)
+			return
+		}
+		claim = &idempotencyClaim{key: key, caller: idempotencyCaller(r), requestHash: hash}
+		ctx = withIdempotencyClaim(ctx, claim)
+	}
+	resp := Exec(ctx, q)
+	statusCode := StatusCodeOK
+	for _, err := range resp.Errors {
+		if err.ResolverError == ErrServiceUnavailable {
+			RespondServiceUnavailable(w)
+			return
+		}
+		if errors.Is(err.ResolverError, ErrIdempotencyKeyMismatch) {
+			RespondUnprocessable(w)
+			return
+		}
+		if errors.Is(err.ResolverError, ErrIdempotentReplay) {
+			if !claim.response.Valid {
+				RespondConflict(w)
+				return
+			}
+			fmt.Fprint(w, claim.response.String)
+			return
+		}
+		if _, ok := err.ResolverError.(*DisabledError); ok {
+			statusCode = StatusCodeBadRequest
+		}
+	}
+	// Other errors are the client’s to read, so we respond
+	// with them as usual:
+	json, err := json.MarshalIndent(resp, IndentPrefix, IndentString)
+	if err != nil {
+		RespondServerError(w)
+		log.Printf("json.MarshalIndent: %s", err)
+		return
+	}
+	// Once the claim has committed, the mutation has happened,
+	// so we store the response even if a later field failed:
+	if claim != nil && claim.claimed {
+		err := storeIdempotentResponse(r.Context(), claim.key, string(json))
+		if err != nil {
+			log.Printf("storeIdempotentResponse: %s", err)
+		}
+	}
+	w.WriteHeader(statusCode)
+	fmt.Fprint(w, string(json))
+}
+
+/*
+ * Server-sent events
+ *
+ * /graphql/sse runs a subscription over server-sent events, a
+ * simpler transport than WebSockets: the response stays open
+ * and each result is a frame, e.g.:
+ *
+ * $ curl -N 'localhost:8000/graphql/sse?query=subscription{noteCreated{note{data}}}'
+ *
+ * event: next
+ * data: {"data":{"noteCreated":{"note":{"data":"Hello, world!"}}}}
+ *
+ * The query comes from ?query=, ?operationName=, and
+ * ?variables= (GET, as browsers’ EventSource sends) or a JSON
+ * body (POST). When the client disconnects, the request’s
+ * context is cancelled, which unsubscribes it from the broker.
+ * Each result’s errors are sanitized as Exec’s are (see Error
+ * detail).
+ *
+ * A client that vanishes without closing the connection, e.g.
+ * behind a proxy, never cancels the context. So every
+ * -sse-keepalive we send a comment line, which clients
+ * ignore:
+ *
+ * : ping
+ *
+ * and a write that fails means the client is gone. SSE has no
+ * pong, so that failed write is how we notice. A subscription
+ * that gets no results for -sse-idle-timeout is completed and
+ * closed either way; clients can reconnect.
+ */
+
+var (
+	sseKeepAlive   = flag.Duration("sse-keepalive", 15*time.Second, "how often to ping server-sent event clients")
+	sseIdleTimeout = flag.Duration("sse-idle-timeout", 10*time.Minute, "close subscriptions without results for this long")
+)
+
+func handleSSE(w http.ResponseWriter, r *http.Request) {
+	var q ClientQuery
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		q.Query = params.Get("query")
+		q.OpName = params.Get("operationName")
+		if variables := params.Get("variables"); variables != "" {
+			err := json.Unmarshal([]byte(variables), &q.Variables)
+			if err != nil {
+				RespondBadRequest(w)
+				log.Printf("json.Unmarshal: %s", err)
+				return
+			}
+		}
+	case http.MethodPost:
+		err := json.NewDecoder(r.Body).Decode(&q)
+		if err != nil {
+			RespondBadRequest(w)
+			log.Printf("json.Decode: %s", err)
+			return
+		}
+	default:
+		RespondNotFound(w)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		RespondServerError(w)
+		log.Printf("handleSSE: %T can’t flush", w)
+		return
+	}
+	// Cancelled when we return, however we return, which
+	// unsubscribes us from the broker:
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	ctx = withRole(ctx, roleFor(r))
+	ctx = withLocale(ctx, localeFor(r))
+	results, err := Schema.Subscribe(ctx, q.Query, q.OpName, q.Variables)
+	if err != nil {
+		RespondServerError(w)
+		log.Printf("Schema.Subscribe: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(StatusCodeOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(*sseKeepAlive)
+	defer keepAlive.Stop()
+	idle := time.NewTimer(*sseIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": ping\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-idle.C:
+			fmt.Fprint(w, "event: complete\ndata:\n\n")
+			flusher.Flush()
+			return
+		case result, ok := <-results:
+			if !ok {
+				fmt.Fprint(w, "event: complete\ndata:\n\n")
+				flusher.Flush()
+				return
+			}
+			if resp, ok := result.(*graphql.Response); ok {
+				sanitizeErrors(resp)
+			}
+			// Frames end at a blank line, so the JSON has to be on
+			// one line, i.e. not indented:
+			bstr, err := json.Marshal(result)
+			if err != nil {
+				log.Printf("json.Marshal: %s", err)
+				return
+			}
+			fmt.Fprintf(w, "event: next\ndata: %s\n\n", bstr)
+			flusher.Flush()
+			// A result is activity, so the idle timeout starts
+			// over:
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(*sseIdleTimeout)
+		}
+	}
+}
+
+/*
+ * Idempotency keys
+ *
+ * A client that times out waiting for createNote can’t tell
+ * whether the note was created. If it sends an
+ * Idempotency-Key header, it can safely retry: the first
+ * mutation transaction claims the key (see runInTx) and we
+ * store its response, which retries get back for 24 hours
+ * instead of executing the mutation again.
+ *
+ * The claim is an INSERT in the mutation’s own transaction,
+ * so of two concurrent requests with the same key, the second
+ * waits on the first’s row and then finds the key taken: a
+ * mutation can’t run twice. Only mutations run in runInTx, so
+ * the key never applies to queries. A retry that arrives
+ * before the response is stored gets 409 Conflict.
+ *
+ * The key is stored with the caller and a hash of the
+ * request, and reusing it for another caller or another
+ * request gets 422 Unprocessable Entity rather than someone
+ * else’s response.
+ */
+
+var (
+	ErrIdempotentReplay       = errors.New("this Idempotency-Key was already used for this request")
+	ErrIdempotencyKeyMismatch = errors.New("this Idempotency-Key was used for a different request")
+)
+
+type idempotencyKey struct{}
+
+// idempotencyClaim is one request’s key. claimed is set once
+// a transaction has claimed the key; response is the stored
+// response found by a retry.
+type idempotencyClaim struct {
+	key         string
+	caller      string
+	requestHash string
+
+	mu       sync.Mutex
+	claimed  bool
+	response sql.NullString
+}
+
+func withIdempotencyClaim(ctx context.Context, claim *idempotencyClaim) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, claim)
+}
+
+func idempotencyClaimFrom(ctx context.Context) *idempotencyClaim {
+	claim, _ := ctx.Value(idempotencyKey{}).(*idempotencyClaim)
+	return claim
+}
+
+// idempotencyCaller identifies the caller by its credentials,
+// hashed so we don’t store them, or else its IP address:
+func idempotencyCaller(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		return "auth:" + hex.EncodeToString(sum[:])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// requestHash hashes the operation and its variables.
+// json.Marshal sorts map keys, so equal requests hash alike.
+func requestHash(q ClientQuery) (string, error) {
+	bstr, err := json.Marshal(q)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bstr)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// claim inserts the key in tx and reports whether this call
+// claimed it. A key that’s already taken, and not expired,
+// fails the transaction with ErrIdempotentReplay, or with
+// ErrIdempotencyKeyMismatch for another caller or request.
+func (c *idempotencyClaim) claim(ctx context.Context, tx *sql.Tx) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.claimed {
+		return false, nil
+	}
+	var key string
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (
+			key,
+			caller,
+			request_hash )
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE
+		SET
+			caller = excluded.caller,
+			request_hash = excluded.request_hash,
+			response = NULL,
+			created_at = now()
+		WHERE idempotency_keys.created_at <= now() - interval '24 hours'
+		RETURNING key
+	`, c.key, c.caller, c.requestHash).Scan(&key)
+	if err == nil {
+		c.claimed = true
+		return true, nil
+	} else if err != sql.ErrNoRows {
+		return false, err
+	}
+	var caller, hash string
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			caller,
+			request_hash,
+			response
+		FROM idempotency_keys
+		WHERE key = $1
+	`, c.key).Scan(&caller, &hash, &c.response)
+	if err != nil {
+		return false, err
+	}
+	if caller != c.caller || hash != c.requestHash {
+		return false, ErrIdempotencyKeyMismatch
+	}
+	return false, ErrIdempotentReplay
+}
+
+// release forgets a claim whose transaction rolled back:
+func (c *idempotencyClaim) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.claimed = false
 }
 
-func (r *RootResolver) User(args struct{ UserID graphql.ID }) (*UserResolver, error) {
-	user := &User{}
-	err := DB.QueryRow(`
-		SELECT
-			user_id,
-			username
-		FROM users
-		WHERE user_id = $1
-	`, args.UserID).Scan(&user.UserID, &user.Username)
-	if err != nil {
-		return nil, err
+// storeIdempotentResponse stores the response for a claimed
+// key:
+func storeIdempotentResponse(ctx context.Context, key, resp string) error {
+	return timeQuery(ctx, "storeIdempotentResponse", func() error {
+		_, err := DB.ExecContext(ctx, `
+			UPDATE idempotency_keys
+			SET response = $2
+			WHERE key = $1
+		`, key, resp)
+		return err
+	})
+}
+
+/*
+ * Bulk import
+ *
+ * POST /import/notes takes newline-delimited JSON, one note
+ * per line:
+ *
+ * {"userID":"u-33e723","data":"Hello, world!"}
+ * {"userID":"u-33e723","data":"Hello again, world!"}
+ *
+ * and responds with a summary:
+ *
+ * {"created":2,"failed":0,"errors":[]}
+ *
+ * We read the body a line at a time, so an import never sits
+ * in memory all at once, and insert ImportBatchSize notes per
+ * transaction. A bad line is reported and skipped; with
+ * ?stopOnError=true, the import stops at the first bad line
+ * instead (notes from earlier lines are kept). A line longer
+ * than MaxImportLineSize is a bad line too: we skip to its
+ * end without keeping it in memory.
+ */
+
+const (
+	ImportBatchSize   = 100
+	MaxImportLineSize = 1 << 20 // 1 MB
+)
+
+type importLine struct {
+	UserID graphql.ID `json:"userID"`
+	Data   string     `json:"data"`
+}
+
+type importError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type importSummary struct {
+	Created int           `json:"created"`
+	Failed  int           `json:"failed"`
+	Errors  []importError `json:"errors"`
+}
+
+func handleImportNotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RespondNotFound(w)
+		return
 	}
-	return &UserResolver{user}, nil
+	stopOnError := r.URL.Query().Get("stopOnError") == "true"
+	summary, err := importNotes(r.Context(), r.Body, stopOnError)
+	var disabledErr *DisabledError
+	if errors.As(err, &disabledErr) {
+		RespondBadRequest(w)
+		log.Printf("importNotes: %s", err)
+		return
+	} else if err != nil {
+		RespondServerError(w)
+		log.Printf("importNotes: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
 }
 
-func (r *RootResolver) Notes(args struct{ UserID graphql.ID }) ([]*NoteResolver, error) {
-	var noteRxs []*NoteResolver
-	rows, err := DB.Query(`
-		SELECT
-			note_id,
-			data
-		FROM notes
-		WHERE user_id = $1
-	`, args.UserID)
+// importNotes inserts each line under a savepoint: a failed
+// insert, e.g. for an unknown user, rolls back to the
+// savepoint rather than aborting the whole batch.
+func importNotes(ctx context.Context, body io.Reader, stopOnError bool) (*importSummary, error) {
+	err := requireEnabled("importNotes")
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		note := &Note{}
-		err := rows.Scan(&note.NoteID, &note.Data)
-		if err != nil {
+	summary := &importSummary{Errors: []importError{}}
+	reader := bufio.NewReaderSize(body, 64*1024)
+	var tx *sql.Tx
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+	lineNo, batched := 0, 0
+	for {
+		raw, tooLong, err := readImportLine(reader)
+		if err == io.EOF {
+			break
+		} else if err != nil {
 			return nil, err
 		}
-		noteRxs = append(noteRxs, &NoteResolver{note})
+		lineNo++
+		if !tooLong && strings.TrimSpace(string(raw)) == "" {
+			continue
+		}
+		var line importLine
+		if tooLong {
+			err = fmt.Errorf("line is longer than %d bytes", MaxImportLineSize)
+		} else {
+			err = json.Unmarshal(raw, &line)
+		}
+		if err == nil && line.UserID == "" {
+			err = errors.New("userID is required")
+		} else if err == nil && line.Data == "" {
+			err = errors.New("data is required")
+		} else if err == nil {
+			err = checkBlocklist(line.Data)
+		}
+		if err == nil {
+			if tx == nil {
+				tx, err = DB.BeginTx(ctx, nil)
+				if err != nil {
+					return nil, err
+				}
+			}
+			err = importNote(tx, line)
+		}
+		if err != nil {
+			summary.Failed++
+			summary.Errors = append(summary.Errors, importError{lineNo, err.Error()})
+			if stopOnError {
+				break
+			}
+			continue
+		}
+		summary.Created++
+		batched++
+		if batched == ImportBatchSize {
+			err := tx.Commit()
+			tx, batched = nil, 0
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
-	err = rows.Err()
-	if err != nil {
-		return nil, err
+	if tx != nil {
+		err := tx.Commit()
+		tx = nil
+		if err != nil {
+			return nil, err
+		}
 	}
-	return noteRxs, nil
+	return summary, nil
 }
 
-func (r *RootResolver) Note(args struct{ NoteID graphql.ID }) (*NoteResolver, error) {
-	note := &Note{}
-	err := DB.QueryRow(`
-		SELECT
-			note_id,
-			data
-		FROM notes
-		WHERE note_id = $1
-	`, args.NoteID).Scan(&note.NoteID, &note.Data)
-	if err != nil {
-		return nil, err
+// readImportLine returns the next line without its newline.
+// Past MaxImportLineSize, it stops keeping the line and reads
+// on to its end, reporting tooLong. At the end of the body,
+// it returns io.EOF.
+func readImportLine(r *bufio.Reader) (line []byte, tooLong bool, err error) {
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, false, err
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+			if len(line) > MaxImportLineSize {
+				line, tooLong = nil, true
+			}
+		}
+		if !isPrefix {
+			return line, tooLong, nil
+		}
 	}
-	return &NoteResolver{note}, nil
-}
-
-type CreateNoteArgs struct {
-	UserID graphql.ID
-	Note   NoteInput
 }
 
-func (r *RootResolver) CreateNote(args CreateNoteArgs) (*NoteResolver, error) {
-	tx, err := DB.Begin()
+func importNote(tx *sql.Tx, line importLine) error {
+	_, err := tx.Exec(`SAVEPOINT import_line`)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer tx.Rollback()
-	var noteID string
-	err = tx.QueryRow(`
+	_, err = tx.Exec(`
 		INSERT INTO notes (
 			user_id,
 			data )
 		VALUES ($1, $2)
-		RETURNING note_id
-	`, args.UserID, args.Note.Data).Scan(&noteID)
-	if err != nil {
-		return nil, err
-	}
-	err = tx.Commit()
+	`, line.UserID, line.Data)
 	if err != nil {
-		return nil, err
+		_, rollbackErr := tx.Exec(`ROLLBACK TO SAVEPOINT import_line`)
+		if rollbackErr != nil {
+			return rollbackErr
+		}
+		return err
 	}
-	return r.Note(struct{ NoteID graphql.ID }{graphql.ID(noteID)})
+	_, err = tx.Exec(`RELEASE SAVEPOINT import_line`)
+	return err
 }
 
 /*
- * UserResolver
+ * Export
+ *
+ * GET /export/notes?token=... responds with one user’s notes
+ * as newline-delimited JSON, the format /import/notes takes.
+ * The token comes from the exportToken mutation, so an export
+ * link works on its own, e.g. in a download manager, without
+ * the caller’s Authorization header. Admins can skip the token
+ * and name the user instead:
+ *
+ * $ curl -H "Authorization: Bearer $ADMIN_API_KEY" localhost:8000/export/notes?userID=...
+ *
+ * Anyone else gets 403 Forbidden.
+ *
+ * Exports can be large, so the response carries a weak ETag
+ * and a client that sends it back in If-None-Match gets 304
+ * Not Modified when nothing has changed.
  */
 
-type UserResolver struct{ u *User }
+// ExportTokenTTL is how long an export token is valid:
+var ExportTokenTTL = 15 * time.Minute
 
-func (r *UserResolver) UserID() graphql.ID {
-	return r.u.UserID
-}
+// ExportTokenSecret signs export tokens; it’s loaded from
+// EXPORT_TOKEN_SECRET. Without it, no tokens are issued and
+// none validate.
+var ExportTokenSecret []byte
 
-func (r *UserResolver) Username() string {
-	return r.u.Username
+var (
+	ErrExportDisabled     = errors.New("export is disabled; set EXPORT_TOKEN_SECRET to enable it")
+	ErrInvalidExportToken = errors.New("invalid export token")
+	ErrExpiredExportToken = errors.New("export token has expired")
+)
+
+// An export token is base64("$expiry:$userID") + "." +
+// base64(HMAC-SHA256 of the same), so it can’t be changed
+// without the secret. The expiry comes first because it can’t
+// contain a colon.
+func signExportToken(userID graphql.ID, expiry time.Time) string {
+	payload := fmt.Sprintf("%d:%s", expiry.Unix(), userID)
+	mac := hmac.New(sha256.New, ExportTokenSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
 }
 
-func (r *UserResolver) Notes() ([]*NoteResolver, error) {
-	rootRx := &RootResolver{}
-	return rootRx.Notes(struct{ UserID graphql.ID }{UserID: r.u.UserID})
+// verifyExportToken returns the user ID of a valid token. The
+// signature is checked before the payload is trusted:
+func verifyExportToken(token string, now time.Time) (graphql.ID, error) {
+	if len(ExportTokenSecret) == 0 {
+		return "", ErrInvalidExportToken
+	}
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidExportToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", ErrInvalidExportToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return "", ErrInvalidExportToken
+	}
+	mac := hmac.New(sha256.New, ExportTokenSecret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return "", ErrInvalidExportToken
+	}
+	expiryStr, userID, ok := strings.Cut(string(payload), ":")
+	if !ok {
+		return "", ErrInvalidExportToken
+	}
+	expiry, err := strconv.ParseInt(expiryStr, 10, 64)
+	if err != nil {
+		return "", ErrInvalidExportToken
+	}
+	if now.After(time.Unix(expiry, 0)) {
+		return "", ErrExpiredExportToken
+	}
+	return graphql.ID(userID), nil
 }
 
-/*
- * NoteResolver
- */
+type exportLine struct {
+	UserID graphql.ID `json:"userID"`
+	NoteID graphql.ID `json:"noteID"`
+	Data   string     `json:"data"`
+	Status string     `json:"status"`
+}
 
-type NoteResolver struct{ n *Note }
+// notesETag is derived from the user’s latest updated_at,
+// which changes whenever a note is created or changed, and
+// the number of notes, which changes when one is deleted.
+func notesETag(ctx context.Context, userID graphql.ID) (string, error) {
+	var (
+		updatedAt sql.NullTime
+		count     int64
+	)
+	err := timeQuery(ctx, "notesETag", func() error {
+		return DB.QueryRowContext(ctx, `
+			SELECT
+				max(updated_at),
+				count(*)
+			FROM notes
+			WHERE user_id = $1
+		`, userID).Scan(&updatedAt, &count)
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`W/"%d-%d"`, updatedAt.Time.UnixNano(), count), nil
+}
 
-func (r *NoteResolver) NoteID() graphql.ID {
-	return r.n.NoteID
+// exportUserID returns the user whose notes to export: the
+// token’s user or, for admins without a token, ?userID=...
+func exportUserID(r *http.Request) (graphql.ID, error) {
+	params := r.URL.Query()
+	if params.Get("token") == "" && roleFor(r) == RoleAdmin && params.Get("userID") != "" {
+		return graphql.ID(params.Get("userID")), nil
+	}
+	return verifyExportToken(params.Get("token"), time.Now())
 }
 
-func (r *NoteResolver) Data() string {
-	return r.n.Data
+func handleExportNotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondNotFound(w)
+		return
+	}
+	userID, err := exportUserID(r)
+	if err != nil {
+		RespondForbidden(w)
+		return
+	}
+	etag, err := notesETag(r.Context(), userID)
+	if err != nil {
+		RespondServerError(w)
+		log.Printf("notesETag: %s", err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	var rows *sql.Rows
+	err = timeQuery(r.Context(), "handleExportNotes", func() (err error) {
+		rows, err = DB.QueryContext(r.Context(), `
+			SELECT
+				user_id,
+				note_id,
+				data,
+				status
+			FROM notes
+			WHERE user_id = $1
+			ORDER BY pinned DESC, position
+		`, userID)
+		return err
+	})
+	if err != nil {
+		RespondServerError(w)
+		log.Printf("DB.Query: %s", err)
+		return
+	}
+	defer rows.Close()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		var line exportLine
+		err := rows.Scan(&line.UserID, &line.NoteID, &line.Data, &line.Status)
+		if err != nil {
+			// We’ve already responded 200, so all we can do is
+			// stop and log:
+			log.Printf("rows.Scan: %s", err)
+			return
+		}
+		err = enc.Encode(line)
+		if err != nil {
+			log.Printf("json.Encode: %s", err)
+			return
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		log.Printf("rows.Err: %s", err)
+	}
 }
 
 /*
- * main
+ * Self-test
+ *
+ * -selftest runs one query per root query field against the
+ * database and logs PASS or FAIL for each, then exits 1 if
+ * any failed, e.g. as a smoke test after a deploy:
+ *
+ * $ go run main-6.go -selftest
+ *
+ * The examples in main use fixed IDs, so the self-test looks
+ * up a real user and note first and passes them as $userID
+ * and $noteID. Mutations are skipped because they write.
  */
 
-var DB *sql.DB
+var runSelfTest = flag.Bool("selftest", false, "query every root field, report, and exit")
 
-var Schema *graphql.Schema
+// SelfTestQueries has a query per root query field. A field
+// added to the schema without one here fails the self-test:
+var SelfTestQueries = map[string]string{
+	"users":                 `{ users { userID } }`,
+	"user":                  `query($userID: ID!) { user(userID: $userID) { username } }`,
+	"notes":                 `query($userID: ID!) { notes(userID: $userID) { noteID } }`,
+	"note":                  `query($noteID: ID!) { note(noteID: $noteID) { data } }`,
+	"notesByStatus":         `query($userID: ID!) { notesByStatus(userID: $userID) { published { noteID } } }`,
+	"maybeNotes":            `query($userID: ID!) { maybeNotes(userID: $userID) { noteID } }`,
+	"filterNotes":           `query($userID: ID!) { filterNotes(filter: {userID: $userID}) { noteID } }`,
+	"countNotes":            `query($userID: ID!) { countNotes(filter: {userID: $userID}) }`,
+	"matchNotes":            `query($userID: ID!) { matchNotes(userID: $userID, pattern: ".") { noteID } }`,
+	"notesWithTags":         `query($userID: ID!) { notesWithTags(userID: $userID, tags: ["world"]) { noteID } }`,
+	"trendingNotes":         `{ trendingNotes { noteID } }`,
+	"topUsers":              `{ topUsers { noteCount } }`,
+	"longestNotes":          `{ longestNotes { user { userID } } }`,
+	"noteLengthHistogram":   `{ noteLengthHistogram { count } }`,
+	"todaysNotes":           `query($userID: ID!) { todaysNotes(userID: $userID) { noteID } }`,
+	"notesModifiedSince":    `query($userID: ID!) { notesModifiedSince(userID: $userID, since: "1970-01-01T00:00:00Z") { noteID } }`,
+	"randomNotes":           `{ randomNotes { noteID } }`,
+	"similarUsers":          `query($userID: ID!) { similarUsers(userID: $userID) { userID } }`,
+	"areNoteBuddies":        `query($userID: ID!) { areNoteBuddies(userA: $userID, userB: $userID) }`,
+	"countries":             `{ countries }`,
+	"notesByCountry":        `{ notesByCountry { count } }`,
+	"usernameAvailable":     `{ usernameAvailable(username: "selftest") }`,
+	"globalSearch":          `{ globalSearch(query: "o") { users { userID } notes { noteID } } }`,
+	"searchNotesConnection": `{ searchNotesConnection(query: "hello", first: 1) { edges { cursor } } }`,
+	"allNotes":              `{ allNotes(first: 1) { edges { cursor } } }`,
+	"usersConnection":       `{ usersConnection(first: 1) { edges { cursor } } }`,
+	"feed":                  `query($userID: ID!) { feed(userID: $userID) { timestamp } }`,
+	"stats":                 `{ stats { schemaFieldCount } }`,
+	"serverTime":            `{ serverTime }`,
+	"ping":                  `{ ping { ok } }`,
+	"availableOperations":   `{ availableOperations { queries } }`,
+	"echo":                  `{ echo(input: {text: "", number: 0, flag: false, status: DRAFT}) { text } }`,
+}
+
+// selfTest reports whether every root query field passed. It
+// runs as an admin so @auth fields are covered too.
+func selfTest(ctx context.Context) bool {
+	ctx = withRole(ctx, RoleAdmin)
+	resp := Exec(ctx, ClientQuery{Query: `{ users(includeNotes: true) { userID notes { noteID } } }`})
+	if len(resp.Errors) > 0 {
+		log.Printf("FAIL seed lookup: %s", resp.Errors[0])
+		return false
+	}
+	var seed struct {
+		Users []struct {
+			UserID string
+			Notes  []struct{ NoteID string }
+		}
+	}
+	err := json.Unmarshal(resp.Data, &seed)
+	if err != nil {
+		log.Printf("FAIL seed lookup: %s", err)
+		return false
+	}
+	variables := JSON{}
+	for _, user := range seed.Users {
+		if len(user.Notes) > 0 {
+			variables["userID"] = user.UserID
+			variables["noteID"] = user.Notes[0].NoteID
+			break
+		}
+	}
+	if len(variables) == 0 {
+		log.Printf("FAIL seed lookup: no user has notes")
+		return false
+	}
+
+	passed := true
+	queryType := Schema.ASTSchema().EntryPoints["query"].(*types.ObjectTypeDefinition)
+	for _, field := range queryType.Fields {
+		query, ok := SelfTestQueries[field.Name]
+		if !ok {
+			log.Printf("FAIL %s: no self-test query", field.Name)
+			passed = false
+			continue
+		}
+		// GraphQL rejects unused variables, so we only pass the
+		// ones the query declares:
+		q := ClientQuery{Query: query, Variables: JSON{}}
+		for name, value := range variables {
+			if strings.Contains(query, "$"+name) {
+				q.Variables[name] = value
+			}
+		}
+		resp := Exec(ctx, q)
+		if len(resp.Errors) > 0 {
+			log.Printf("FAIL %s: %s", field.Name, resp.Errors[0])
+			passed = false
+			continue
+		}
+		log.Printf("PASS %s", field.Name)
+	}
+	return passed
+}
 
 func check(err error, desc string) {
 	if err == nil {
@@ -231,32 +5606,65 @@ func check(err error, desc string) {
 	panic(errStr)
 }
 
+// Indentation for printed JSON (see main-2):
+var (
+	IndentPrefix = ""
+	IndentString = "\t"
+)
+
 func main() {
-	// Connect to database:
+	flag.Parse()
+
+	// Connect to database and, if REPLICA_DATABASE_URL is
+	// set, the read replica:
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = "postgres://zaydek@localhost/graph_gophers?sslmode=disable"
+	}
 	var err error
-	DB, err = sql.Open("postgres", "postgres://zaydek@localhost/graph_gophers?sslmode=disable")
+	DB, err = sql.Open("postgres", dsn)
 	check(err, "sql.Open")
 	err = DB.Ping()
 	check(err, "DB.Ping")
 	defer DB.Close()
+	DB.SetConnMaxIdleTime(*dbMaxIdleTime)
+	if replicaDSN := os.Getenv("REPLICA_DATABASE_URL"); replicaDSN != "" {
+		ReplicaDB, err = sql.Open("postgres", replicaDSN)
+		check(err, "sql.Open")
+		err = ReplicaDB.Ping()
+		check(err, "ReplicaDB.Ping")
+		defer ReplicaDB.Close()
+		ReplicaDB.SetConnMaxIdleTime(*dbMaxIdleTime)
+	}
 
 	// Parse schema:
 	bstr, err := ioutil.ReadFile("./main-6-schema.graphql")
 	check(err, "ioutil.ReadFile")
 	schemaString := string(bstr)
-	Schema, err = graphql.ParseSchema(schemaString, &RootResolver{})
+	Schema, err = graphql.ParseSchema(schemaString, &RootResolver{}, graphql.UseStringDescriptions(), graphql.Tracer(statsTracer{}))
 	check(err, "graphql.ParseSchema")
+	FieldRoles = loadFieldRoles(Schema)
+	AvailableOperations = loadOperations(Schema)
+	DisabledMutations = loadDisabledMutations(os.Getenv("DISABLED_MUTATIONS"))
+	DebugErrors = os.Getenv("DEBUG_ERRORS") == "true"
+	ExportTokenSecret = []byte(os.Getenv("EXPORT_TOKEN_SECRET"))
 
-	ctx := context.Background()
-
-	type JSON = map[string]interface{}
+	if *printAllowList {
+		allowList, err := GenerateOperationAllowList(Schema)
+		check(err, "GenerateOperationAllowList")
+		fmt.Println(strings.Join(allowList, "\n"))
+		return
+	}
 
-	type ClientQuery struct {
-		OpName    string
-		Query     string
-		Variables JSON
+	if *runSelfTest {
+		if !selfTest(context.Background()) {
+			os.Exit(1)
+		}
+		return
 	}
 
+	ctx := context.Background()
+
 	q1 := ClientQuery{
 		OpName: "Users",
 		Query: `query Users {
@@ -267,8 +5675,8 @@ func main() {
 		}`,
 		Variables: nil,
 	}
-	resp1 := Schema.Exec(ctx, q1.Query, q1.OpName, q1.Variables)
-	json1, err := json.MarshalIndent(resp1, "", "\t")
+	resp1 := Exec(ctx, q1)
+	json1, err := json.MarshalIndent(resp1, IndentPrefix, IndentString)
 	check(err, "json.MarshalIndent")
 	fmt.Println(string(json1))
 	// Expected output:
@@ -304,8 +5712,8 @@ func main() {
 			"userID": "u-f4ff7e",
 		},
 	}
-	resp2 := Schema.Exec(ctx, q2.Query, q2.OpName, q2.Variables)
-	json2, err := json.MarshalIndent(resp2, "", "\t")
+	resp2 := Exec(ctx, q2)
+	json2, err := json.MarshalIndent(resp2, IndentPrefix, IndentString)
 	check(err, "json.MarshalIndent")
 	fmt.Println(string(json2))
 	// Expected output:
@@ -331,8 +5739,8 @@ func main() {
 			"userID": "u-f4ff7e",
 		},
 	}
-	resp3 := Schema.Exec(ctx, q3.Query, q3.OpName, q3.Variables)
-	json3, err := json.MarshalIndent(resp3, "", "\t")
+	resp3 := Exec(ctx, q3)
+	json3, err := json.MarshalIndent(resp3, IndentPrefix, IndentString)
 	check(err, "json.MarshalIndent")
 	fmt.Println(string(json3))
 	// Expected output:
@@ -368,8 +5776,8 @@ func main() {
 			"noteID": "n-b2c043",
 		},
 	}
-	resp4 := Schema.Exec(ctx, q4.Query, q4.OpName, q4.Variables)
-	json4, err := json.MarshalIndent(resp4, "", "\t")
+	resp4 := Exec(ctx, q4)
+	json4, err := json.MarshalIndent(resp4, IndentPrefix, IndentString)
 	check(err, "json.MarshalIndent")
 	fmt.Println(string(json4))
 	// Expected output:
@@ -398,8 +5806,8 @@ func main() {
 			},
 		},
 	}
-	resp5 := Schema.Exec(ctx, q5.Query, q5.OpName, q5.Variables)
-	json5, err := json.MarshalIndent(resp5, "", "\t")
+	resp5 := Exec(ctx, q5)
+	json5, err := json.MarshalIndent(resp5, IndentPrefix, IndentString)
 	check(err, "json.MarshalIndent")
 	fmt.Println(string(json5))
 	// Expected output:
@@ -413,10 +5821,12 @@ func main() {
 	// 	}
 	// }
 
+	// includeNotes loads the same notes in one query rather
+	// than one per user:
 	q6 := ClientQuery{
 		OpName: "Users",
 		Query: `query Users {
-			users {
+			users(includeNotes: true) {
 				userID
 				username
 				notes {
@@ -427,8 +5837,8 @@ func main() {
 		}`,
 		Variables: nil,
 	}
-	resp6 := Schema.Exec(ctx, q6.Query, q6.OpName, q6.Variables)
-	json6, err := json.MarshalIndent(resp6, "", "\t")
+	resp6 := Exec(ctx, q6)
+	json6, err := json.MarshalIndent(resp6, IndentPrefix, IndentString)
 	check(err, "json.MarshalIndent")
 	fmt.Println(string(json6))
 	// Expected output:
@@ -451,4 +5861,228 @@ func main() {
 	// 		]
 	// 	}
 	// }
+
+	q7 := ClientQuery{
+		OpName: "NoteStats",
+		Query: `query NoteStats($userID: ID!) {
+			user(userID: $userID) {
+				username
+				noteStats {
+					total
+					averageLength
+					longest {
+						noteID
+						data
+					}
+				}
+			}
+		}`,
+		Variables: JSON{
+			"userID": "u-f4ff7e",
+		},
+	}
+	resp7 := Exec(ctx, q7)
+	json7, err := json.MarshalIndent(resp7, IndentPrefix, IndentString)
+	check(err, "json.MarshalIndent")
+	fmt.Println(string(json7))
+	// Expected output:
+	//
+	// {
+	// 	"data": {
+	// 		"user": {
+	// 			"username": "nyxerys",
+	// 			"noteStats": {
+	// 				"total": 3,
+	// 				"averageLength": 15.333333333333334,
+	// 				"longest": {
+	// 					"noteID": "n-95d818",
+	// 					"data": "Olá novamente, mundo!"
+	// 				}
+	// 			}
+	// 		}
+	// 	}
+	// }
+
+	// createUserValidated reports every bad field at once:
+	q8 := ClientQuery{
+		OpName: "CreateUserValidated",
+		Query: `mutation CreateUserValidated($input: NewUserInput!) {
+			createUserValidated(input: $input) {
+				user {
+					userID
+				}
+				userErrors {
+					field
+					message
+				}
+			}
+		}`,
+		Variables: JSON{
+			"input": JSON{
+				"username": "zy",
+				"emoji":    "🇵",
+			},
+		},
+	}
+	resp8 := Exec(ctx, q8)
+	json8, err := json.MarshalIndent(resp8, IndentPrefix, IndentString)
+	check(err, "json.MarshalIndent")
+	fmt.Println(string(json8))
+	// Expected output:
+	//
+	// {
+	// 	"data": {
+	// 		"createUserValidated": {
+	// 			"user": null,
+	// 			"userErrors": [
+	// 				{
+	// 					"field": "username",
+	// 					"message": "must be 3-8 characters"
+	// 				},
+	// 				{
+	// 					"field": "emoji",
+	// 					"message": "must be a single flag"
+	// 				}
+	// 			]
+	// 		}
+	// 	}
+	// }
+
+	// notesByCountry rolls the seeded notes up by flag:
+	q9 := ClientQuery{
+		OpName: "NotesByCountry",
+		Query: `query NotesByCountry {
+			notesByCountry {
+				emoji
+				count
+			}
+		}`,
+	}
+	resp9 := Exec(ctx, q9)
+	json9, err := json.MarshalIndent(resp9, IndentPrefix, IndentString)
+	check(err, "json.MarshalIndent")
+	fmt.Println(string(json9))
+	// Expected output:
+	//
+	// {
+	// 	"data": {
+	// 		"notesByCountry": [
+	// 			{
+	// 				"emoji": "🇵🇹",
+	// 				"count": 3
+	// 			},
+	// 			{
+	// 				"emoji": "🇺🇦",
+	// 				"count": 3
+	// 			},
+	// 			{
+	// 				"emoji": "🇺🇸",
+	// 				"count": 3
+	// 			}
+	// 		]
+	// 	}
+	// }
+
+	// With matchAll, a note needs every tag; tags are case-
+	// insensitive:
+	q10 := ClientQuery{
+		OpName: "NotesWithTags",
+		Query: `query NotesWithTags($userID: ID!, $tags: [String!]!) {
+			notesWithTags(userID: $userID, tags: $tags, matchAll: true) {
+				noteID
+				data
+			}
+		}`,
+		Variables: JSON{
+			"userID": "u-f4ff7e",
+			"tags":   []interface{}{"World", "again"},
+		},
+	}
+	resp10 := Exec(ctx, q10)
+	json10, err := json.MarshalIndent(resp10, IndentPrefix, IndentString)
+	check(err, "json.MarshalIndent")
+	fmt.Println(string(json10))
+	// Expected output:
+	//
+	// {
+	// 	"data": {
+	// 		"notesWithTags": [
+	// 			{
+	// 				"noteID": "n-95d818",
+	// 				"data": "Olá novamente, mundo!"
+	// 			}
+	// 		]
+	// 	}
+	// }
+
+	// echo round-trips variables, nulls included:
+	q11 := ClientQuery{
+		OpName: "Echo",
+		Query: `query Echo($input: EchoInput!) {
+			echo(input: $input) {
+				text
+				number
+				flag
+				status
+				note
+			}
+		}`,
+		Variables: JSON{
+			"input": JSON{
+				"text":   "Olá Mundo!",
+				"number": 42,
+				"flag":   true,
+				"status": "DRAFT",
+				"note":   nil,
+			},
+		},
+	}
+	resp11 := Exec(ctx, q11)
+	json11, err := json.MarshalIndent(resp11, IndentPrefix, IndentString)
+	check(err, "json.MarshalIndent")
+	fmt.Println(string(json11))
+	// Expected output:
+	//
+	// {
+	// 	"data": {
+	// 		"echo": {
+	// 			"text": "Olá Mundo!",
+	// 			"number": 42,
+	// 			"flag": true,
+	// 			"status": "DRAFT",
+	// 			"note": null
+	// 		}
+	// 	}
+	// }
+
+	if *addr != "" {
+		// Stop the background workers and shut down gracefully
+		// on interrupt (see main-7):
+		serveCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		go runPruner(serveCtx, *pruneInterval, *pruneRetention)
+		if *poolStatsInterval > 0 {
+			go logPoolStats(serveCtx, *poolStatsInterval)
+		}
+
+		http.HandleFunc("/graphql", handleGraphQL)
+		http.HandleFunc("/graphql/sse", handleSSE)
+		http.HandleFunc("/import/notes", handleImportNotes)
+		http.HandleFunc("/export/notes", handleExportNotes)
+		srv := &http.Server{Addr: *addr}
+		go func() {
+			<-serveCtx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := srv.Shutdown(shutdownCtx)
+			if err != nil {
+				log.Printf("srv.Shutdown: %s", err)
+			}
+		}()
+		log.Printf("Serving HTTP on %s", *addr)
+		err := srv.ListenAndServe()
+		if err != http.ErrServerClosed {
+			check(err, "srv.ListenAndServe")
+		}
+	}
 }
@@ -1,15 +1,36 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"github.com/graph-gophers/graphql-go/trace/tracer"
 )
 
 // This example builds on main-2.go. The intent of this
@@ -25,36 +46,39 @@ import (
 
 // stripe.com/docs/api/errors
 const (
-	StatusCodeOK              = 200
-	StatusCodeBadRequest      = 400
-	StatusCodeUnauthorized    = 401
-	StatusCodeRequestFailed   = 402
-	StatusCodeNotFound        = 404
-	StatusCodeConflict        = 409
-	StatusCodeTooManyRequests = 429
-	StatusCodeServerError     = 500
+	StatusCodeOK               = 200
+	StatusCodeBadRequest       = 400
+	StatusCodeUnauthorized     = 401
+	StatusCodeRequestFailed    = 402
+	StatusCodeNotFound         = 404
+	StatusCodeMethodNotAllowed = 405
+	StatusCodeConflict         = 409
+	StatusCodeTooManyRequests  = 429
+	StatusCodeServerError      = 500
 )
 
 var Statuses = map[int]string{
-	StatusCodeOK:              "OK",
-	StatusCodeBadRequest:      "Bad Request",
-	StatusCodeUnauthorized:    "Unauthorized",
-	StatusCodeRequestFailed:   "Request Failed",
-	StatusCodeNotFound:        "Not Found",
-	StatusCodeConflict:        "Conflict",
-	StatusCodeTooManyRequests: "Too Many Requests",
-	StatusCodeServerError:     "Server Error",
+	StatusCodeOK:               "OK",
+	StatusCodeBadRequest:       "Bad Request",
+	StatusCodeUnauthorized:     "Unauthorized",
+	StatusCodeRequestFailed:    "Request Failed",
+	StatusCodeNotFound:         "Not Found",
+	StatusCodeMethodNotAllowed: "Method Not Allowed",
+	StatusCodeConflict:         "Conflict",
+	StatusCodeTooManyRequests:  "Too Many Requests",
+	StatusCodeServerError:      "Server Error",
 }
 
 var (
-	RespondOK              = NewResponder(StatusCodeOK)
-	RespondBadRequest      = NewResponder(StatusCodeBadRequest)
-	RespondUnauthorized    = NewResponder(StatusCodeUnauthorized)
-	RespondRequestFailed   = NewResponder(StatusCodeRequestFailed)
-	RespondNotFound        = NewResponder(StatusCodeNotFound)
-	RespondConflict        = NewResponder(StatusCodeConflict)
-	RespondTooManyRequests = NewResponder(StatusCodeTooManyRequests)
-	RespondServerError     = NewResponder(StatusCodeServerError)
+	RespondOK               = NewResponder(StatusCodeOK)
+	RespondBadRequest       = NewResponder(StatusCodeBadRequest)
+	RespondUnauthorized     = NewResponder(StatusCodeUnauthorized)
+	RespondRequestFailed    = NewResponder(StatusCodeRequestFailed)
+	RespondNotFound         = NewResponder(StatusCodeNotFound)
+	RespondMethodNotAllowed = NewResponder(StatusCodeMethodNotAllowed)
+	RespondConflict         = NewResponder(StatusCodeConflict)
+	RespondTooManyRequests  = NewResponder(StatusCodeTooManyRequests)
+	RespondServerError      = NewResponder(StatusCodeServerError)
 )
 
 func NewResponder(statusCode int) func(http.ResponseWriter) {
@@ -69,47 +93,1158 @@ func NewResponder(statusCode int) func(http.ResponseWriter) {
 	return respond
 }
 
+// Negotiating responders are like responders, but respond to
+// clients that send “Accept: application/json” with errors
+// they can parse:
+//
+// {"errors":[{"message":"Bad Request"}]}
+//
+// Everyone else gets plain text, as before. Messages add
+// detail; without them, the status is the message.
+
+var (
+	NegotiateBadRequest       = NewNegotiatingResponder(StatusCodeBadRequest)
+	NegotiateUnauthorized     = NewNegotiatingResponder(StatusCodeUnauthorized)
+	NegotiateNotFound         = NewNegotiatingResponder(StatusCodeNotFound)
+	NegotiateMethodNotAllowed = NewNegotiatingResponder(StatusCodeMethodNotAllowed)
+	NegotiateRequestFailed    = NewNegotiatingResponder(StatusCodeRequestFailed)
+	NegotiateTooManyRequests  = NewNegotiatingResponder(StatusCodeTooManyRequests)
+	NegotiateServerError      = NewNegotiatingResponder(StatusCodeServerError)
+)
+
+func NewNegotiatingResponder(statusCode int) func(http.ResponseWriter, *http.Request, ...string) {
+	respond := func(w http.ResponseWriter, r *http.Request, messages ...string) {
+		status := Statuses[statusCode]
+		if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+			http.Error(w, strings.Join(append([]string{status}, messages...), "\n"), statusCode)
+			return
+		}
+		if len(messages) == 0 {
+			messages = []string{status}
+		}
+		type jsonError struct {
+			Message    string            `json:"message"`
+			Extensions map[string]string `json:"extensions,omitempty"`
+		}
+		var body struct {
+			Errors []jsonError `json:"errors"`
+		}
+		// The request ID lets a client quote the error back to
+		// us (see withRequestID):
+		var extensions map[string]string
+		if id := requestID(r.Context()); id != "" {
+			extensions = map[string]string{"requestID": id}
+		}
+		for _, message := range messages {
+			body.Errors = append(body.Errors, jsonError{message, extensions})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(body)
+	}
+	return respond
+}
+
 /*
- * main
+ * Schema
  */
+
 const schemaString = `
 	schema {
 		query: Query
+		mutation: Mutation
+	}
+	# Files sent per the GraphQL multipart request spec:
+	scalar Upload
+	type Attachment {
+		filename: String!
+		size: Int!
+	}
+	type User {
+		userID: ID!
+		username: String!
+		emoji: String!
+	}
+	type Note {
+		noteID: ID!
+		data: String!
+		attachment: Attachment
 	}
 	type Query {
 		greet: String!
+		# The deployed build, e.g. "v1.2.3" or "dev":
+		version: String!
+		users: [User!]!
+		# The user identified by the X-User-ID header:
+		me: User
+	}
+	input NoteInput {
+		data: String!
+	}
+	type Mutation {
+		createNote(userID: ID!, note: NoteInput!): Note!
+		createNoteWithFile(data: String!, file: Upload!): Note!
 	}
 `
 
+type User struct {
+	UserID   graphql.ID
+	Username string
+	Emoji    string
+}
+
+var users = []*User{
+	{UserID: "u-001", Username: "nyxerys", Emoji: "🇵🇹"},
+	{UserID: "u-002", Username: "rdnkta", Emoji: "🇺🇦"},
+	{UserID: "u-003", Username: "username_ZAYDEK", Emoji: "🇺🇸"},
+}
+
+type Note struct {
+	NoteID     graphql.ID
+	UserID     graphql.ID
+	Data       string
+	Attachment *Upload
+}
+
+type NoteInput struct{ Data string }
+
+// Notes are kept in memory (see main-5); requests are served
+// concurrently, so we guard them with a mutex:
+var (
+	notesMu sync.Mutex
+	notes   []*Note
+)
+
 type RootResolver struct{}
 
-func (*RootResolver) Greet() (string, error) {
+func (*RootResolver) Greet(ctx context.Context) (string, error) {
+	hintCache(ctx, "greet")
 	return "Hello, world!", nil
 }
 
-var Schema = graphql.MustParseSchema(schemaString, &RootResolver{})
+// Version is set at build time so clients can tell which
+// deployment they’re talking to:
+//
+// $ go build -ldflags "-X main.Version=v1.2.3" main-7.go
+var Version = "dev"
+
+func (*RootResolver) Version(ctx context.Context) string {
+	hintCache(ctx, "version")
+	return Version
+}
+
+func (*RootResolver) Users(ctx context.Context) []*UserResolver {
+	hintCache(ctx, "users")
+	var userRxs []*UserResolver
+	for _, u := range users {
+		userRxs = append(userRxs, &UserResolver{u})
+	}
+	return userRxs
+}
+
+func (*RootResolver) Me(ctx context.Context) *UserResolver {
+	hintCache(ctx, "me")
+	userID, _ := ctx.Value(userIDKey{}).(graphql.ID)
+	for _, u := range users {
+		if u.UserID == userID {
+			return &UserResolver{u}
+		}
+	}
+	return nil
+}
+
+type CreateNoteArgs struct {
+	UserID graphql.ID
+	Note   NoteInput
+}
+
+func (*RootResolver) CreateNote(ctx context.Context, args CreateNoteArgs) (*NoteResolver, error) {
+	hintCache(ctx, "createNote")
+	notesMu.Lock()
+	defer notesMu.Unlock()
+	note := &Note{
+		NoteID: graphql.ID(fmt.Sprintf("n-%03d", len(notes)+1)),
+		UserID: args.UserID,
+		Data:   args.Note.Data,
+	}
+	notes = append(notes, note)
+	return &NoteResolver{note}, nil
+}
+
+type CreateNoteWithFileArgs struct {
+	Data string
+	File Upload
+}
+
+func (*RootResolver) CreateNoteWithFile(ctx context.Context, args CreateNoteWithFileArgs) (*NoteResolver, error) {
+	hintCache(ctx, "createNoteWithFile")
+	notesMu.Lock()
+	defer notesMu.Unlock()
+	note := &Note{
+		NoteID:     graphql.ID(fmt.Sprintf("n-%03d", len(notes)+1)),
+		Data:       args.Data,
+		Attachment: &args.File,
+	}
+	notes = append(notes, note)
+	return &NoteResolver{note}, nil
+}
+
+type UserResolver struct{ u *User }
+
+func (r *UserResolver) UserID() graphql.ID {
+	return r.u.UserID
+}
+
+func (r *UserResolver) Username() string {
+	return r.u.Username
+}
+
+func (r *UserResolver) Emoji() string {
+	return r.u.Emoji
+}
+
+type NoteResolver struct{ n *Note }
+
+func (r *NoteResolver) NoteID() graphql.ID {
+	return r.n.NoteID
+}
+
+func (r *NoteResolver) UserID() graphql.ID {
+	return r.n.UserID
+}
+
+func (r *NoteResolver) Data() string {
+	return r.n.Data
+}
+
+func (r *NoteResolver) Attachment() *AttachmentResolver {
+	if r.n.Attachment == nil {
+		return nil
+	}
+	return &AttachmentResolver{r.n.Attachment}
+}
+
+type AttachmentResolver struct{ u *Upload }
+
+func (r *AttachmentResolver) Filename() string {
+	return r.u.Filename
+}
+
+func (r *AttachmentResolver) Size() int32 {
+	return int32(len(r.u.Bytes))
+}
+
+var Schema = graphql.MustParseSchema(schemaString, &RootResolver{}, graphql.Tracer(costTracer{}))
+
+/*
+ * Admin schema
+ *
+ * Admin-only fields live in a schema of their own, served at
+ * /admin/graphql, so they never appear in the public schema
+ * — not even through introspection. The admin schema reuses
+ * the public resolvers where it can.
+ */
+
+const adminSchemaString = `
+	schema {
+		query: Query
+		mutation: Mutation
+	}
+	type Note {
+		noteID: ID!
+		# Who wrote the note; only admins can see this:
+		userID: ID!
+		data: String!
+	}
+	type Query {
+		# Every user’s notes:
+		allNotes: [Note!]!
+	}
+	type Mutation {
+		deleteNote(noteID: ID!): Boolean!
+	}
+`
+
+type AdminRootResolver struct{}
+
+func (*AdminRootResolver) AllNotes(ctx context.Context) []*NoteResolver {
+	hintCache(ctx, "allNotes")
+	notesMu.Lock()
+	defer notesMu.Unlock()
+	var noteRxs []*NoteResolver
+	for _, note := range notes {
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	return noteRxs
+}
+
+// DeleteNote returns false when there’s no such note:
+func (*AdminRootResolver) DeleteNote(args struct{ NoteID graphql.ID }) bool {
+	notesMu.Lock()
+	defer notesMu.Unlock()
+	for x, note := range notes {
+		if note.NoteID == args.NoteID {
+			notes = append(notes[:x], notes[x+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+var AdminSchema = graphql.MustParseSchema(adminSchemaString, &AdminRootResolver{}, graphql.Tracer(costTracer{}))
+
+// Schemas routes each path to its schema:
+var Schemas = map[string]*graphql.Schema{
+	"/graphql":       Schema,
+	"/admin/graphql": AdminSchema,
+}
+
+// isAdmin reports whether the request carries
+// “Authorization: Bearer $ADMIN_API_KEY”. Without an
+// ADMIN_API_KEY, no one is an admin.
+func isAdmin(r *http.Request) bool {
+	apiKey := os.Getenv("ADMIN_API_KEY")
+	if apiKey == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	return subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+apiKey)) == 1
+}
+
+// Context keys are unexported types so they can’t collide
+// with other packages’ keys:
+type userIDKey struct{}
+
+/*
+ * Cache hints
+ *
+ * Responses to GET requests can be cached by browsers and
+ * CDNs. Each root field declares how long it may be cached,
+ * and a response is only as cacheable as its least
+ * cacheable field.
+ */
+
+type CacheHint struct {
+	MaxAge  time.Duration
+	Private bool // Per-user data; never store.
+}
+
+// Fields without a hint, e.g. mutations, aren’t cacheable:
+var CacheHints = map[string]CacheHint{
+	"greet":   {MaxAge: time.Hour},
+	"version": {MaxAge: time.Minute},
+	"users":   {MaxAge: 60 * time.Second},
+	"me":      {Private: true},
+	// Admin-only (see AdminSchema):
+	"allNotes": {Private: true},
+}
+
+type cachePolicyKey struct{}
+
+// cachePolicy accumulates the hints of the fields resolved
+// for one request. Resolvers can run concurrently, hence the
+// mutex.
+type cachePolicy struct {
+	mu      sync.Mutex
+	hinted  bool
+	maxAge  time.Duration
+	private bool
+}
+
+func withCachePolicy(ctx context.Context) (context.Context, *cachePolicy) {
+	policy := &cachePolicy{}
+	return context.WithValue(ctx, cachePolicyKey{}, policy), policy
+}
+
+// hintCache records that field was resolved:
+func hintCache(ctx context.Context, field string) {
+	policy, ok := ctx.Value(cachePolicyKey{}).(*cachePolicy)
+	if !ok {
+		return
+	}
+	hint := CacheHints[field]
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	if !policy.hinted || hint.MaxAge < policy.maxAge {
+		policy.maxAge = hint.MaxAge
+	}
+	policy.hinted = true
+	policy.private = policy.private || hint.Private
+}
+
+// Header returns the Cache-Control header for the response:
+func (p *cachePolicy) Header() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.private:
+		return "no-store"
+	case !p.hinted || p.maxAge <= 0:
+		return "no-cache"
+	default:
+		return fmt.Sprintf("public, max-age=%d", int(p.maxAge.Seconds()))
+	}
+}
+
+/*
+ * Query cost
+ *
+ * A query’s cost is the number of fields it resolved. Each
+ * client gets a budget of CostBudget per CostWindow; once
+ * it’s spent, we respond 429 Too Many Requests until the
+ * window resets. Responses report the cost and what’s left,
+ * so clients can throttle themselves:
+ *
+ * X-GraphQL-Cost: 7
+ * X-GraphQL-Cost-Remaining: 993
+ *
+ * Fields are charged as they resolve, not once the query
+ * succeeds, so failed and timed-out queries pay for the work
+ * they did. A field that would overdraw the budget isn’t
+ * resolved: the meter cancels the query’s context, graphql-go
+ * runs no further resolvers, and the client gets 429.
+ */
+
+var (
+	CostBudget = 1000
+	CostWindow = time.Minute
+)
+
+type costKey struct{}
+
+// costMeter charges one query’s fields to its client:
+type costMeter struct {
+	client   string
+	cost     int64
+	exceeded int32
+	cancel   context.CancelFunc
+}
+
+func withCost(ctx context.Context, client string) (context.Context, *costMeter) {
+	ctx, cancel := context.WithCancel(ctx)
+	meter := &costMeter{client: client, cancel: cancel}
+	return context.WithValue(ctx, costKey{}, meter), meter
+}
+
+// Cost is the number of fields charged so far:
+func (m *costMeter) Cost() int64 {
+	return atomic.LoadInt64(&m.cost)
+}
+
+// Exceeded reports whether a field was refused for want of
+// budget:
+func (m *costMeter) Exceeded() bool {
+	return atomic.LoadInt32(&m.exceeded) == 1
+}
+
+// costTracer charges fields as graphql-go resolves them:
+type costTracer struct{}
+
+func (costTracer) TraceQuery(ctx context.Context, queryString, operationName string, variables map[string]interface{}, varTypes map[string]*introspection.Type) (context.Context, tracer.QueryFinishFunc) {
+	return ctx, func([]*gqlerrors.QueryError) {}
+}
+
+func (costTracer) TraceField(ctx context.Context, label, typeName, fieldName string, trivial bool, args map[string]interface{}) (context.Context, tracer.FieldFinishFunc) {
+	if meter, ok := ctx.Value(costKey{}).(*costMeter); ok {
+		if budgets.charge(meter.client, 1) {
+			atomic.AddInt64(&meter.cost, 1)
+		} else {
+			atomic.StoreInt32(&meter.exceeded, 1)
+			meter.cancel()
+		}
+	}
+	return ctx, func(*gqlerrors.QueryError) {}
+}
+
+// costBudgets tracks what each client has spent this window.
+// Clients are identified by their credentials, else by IP
+// address. X-User-ID isn’t a credential: anyone can send any
+// value, so keying on it would let a client reset its budget
+// by changing the header.
+type costBudgets struct {
+	mu      sync.Mutex
+	spent   map[string]int
+	resetAt time.Time
+}
+
+var budgets = &costBudgets{spent: map[string]int{}}
+
+func costClient(r *http.Request) string {
+	if isAdmin(r) {
+		return "admin"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// resetIfDue starts a new window once the last one is over.
+// b.mu must be held.
+func (b *costBudgets) resetIfDue() {
+	if now := time.Now(); now.After(b.resetAt) {
+		b.spent = map[string]int{}
+		b.resetAt = now.Add(CostWindow)
+	}
+}
+
+// charge adds cost to the client’s spending, unless that would
+// overdraw its budget:
+func (b *costBudgets) charge(client string, cost int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resetIfDue()
+	if b.spent[client]+cost > CostBudget {
+		return false
+	}
+	b.spent[client] += cost
+	return true
+}
+
+// remaining returns what’s left of the client’s budget:
+func (b *costBudgets) remaining(client string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resetIfDue()
+	return CostBudget - b.spent[client]
+}
+
+/*
+ * Uploads
+ *
+ * Files can’t be sent as JSON, so the GraphQL multipart
+ * request spec (github.com/jaydenseric/graphql-multipart-request-spec)
+ * sends a multipart/form-data body with three kinds of
+ * fields:
+ *
+ * - operations: the usual JSON query, with null where each
+ *   file goes, e.g. {"variables": {"file": null}, ...}.
+ * - map: which file parts go where, e.g.
+ *   {"0": ["variables.file"]}.
+ * - 0, 1, ...: the file parts themselves.
+ *
+ * Browsers send multipart/form-data cross-site without a CORS
+ * preflight, so any page could otherwise post a mutation with
+ * the visitor’s cookies. Multipart requests must carry a
+ * GraphQL-Require-Preflight header, which a cross-site page
+ * can’t send without the preflight; a plain form can’t send
+ * it at all.
+ */
+
+// MaxUploadSize caps the size of a multipart request:
+const MaxUploadSize = 10 << 20 // 10 MB
+
+// Upload implements the Upload scalar. graphql-go hands
+// custom scalars the raw variable value, which is the
+// *Upload we put there in setVariable.
+type Upload struct {
+	Filename string
+	Bytes    []byte
+}
+
+func (Upload) ImplementsGraphQLType(name string) bool {
+	return name == "Upload"
+}
+
+func (u *Upload) UnmarshalGraphQL(input interface{}) error {
+	upload, ok := input.(*Upload)
+	if !ok {
+		return fmt.Errorf("Upload: expected a file, got %T", input)
+	}
+	*u = *upload
+	return nil
+}
+
+type ClientQuery struct {
+	OpName    string                 `json:"operationName"`
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+	// Extensions are for protocol extensions, e.g. Apollo’s
+	// persisted queries. We don’t implement any, but clients
+	// may send them, so they mustn’t count as unknown fields:
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// setVariable replaces the null at path, e.g. variables.file
+// or variables.files.0, with the upload:
+func setVariable(variables map[string]interface{}, path string, upload *Upload) error {
+	keys := strings.Split(path, ".")
+	if len(keys) < 2 || keys[0] != "variables" {
+		return fmt.Errorf("map: invalid path %q", path)
+	}
+	var parent interface{} = variables
+	for x, key := range keys[1:] {
+		last := x == len(keys)-2
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			child, ok := p[key]
+			if !ok || last && child != nil {
+				return fmt.Errorf("map: invalid path %q", path)
+			}
+			if last {
+				p[key] = upload
+				return nil
+			}
+			parent = child
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(p) || last && p[index] != nil {
+				return fmt.Errorf("map: invalid path %q", path)
+			}
+			if last {
+				p[index] = upload
+				return nil
+			}
+			parent = p[index]
+		default:
+			return fmt.Errorf("map: invalid path %q", path)
+		}
+	}
+	return nil
+}
+
+// parseMultipartQuery reconstructs a ClientQuery from a
+// multipart/form-data request:
+func parseMultipartQuery(w http.ResponseWriter, r *http.Request) (ClientQuery, error) {
+	var q ClientQuery
+	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize)
+	err := r.ParseMultipartForm(MaxUploadSize)
+	if err != nil {
+		return q, err
+	}
+	err = json.Unmarshal([]byte(r.FormValue("operations")), &q)
+	if err != nil {
+		return q, fmt.Errorf("operations: %w", err)
+	}
+	var fileMap map[string][]string
+	err = json.Unmarshal([]byte(r.FormValue("map")), &fileMap)
+	if err != nil {
+		return q, fmt.Errorf("map: %w", err)
+	}
+	for key, paths := range fileMap {
+		file, header, err := r.FormFile(key)
+		if err != nil {
+			return q, fmt.Errorf("map: %s: %w", key, err)
+		}
+		bstr, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return q, err
+		}
+		upload := &Upload{Filename: header.Filename, Bytes: bstr}
+		for _, path := range paths {
+			err := setVariable(q.Variables, path, upload)
+			if err != nil {
+				return q, err
+			}
+		}
+	}
+	return q, nil
+}
+
+// parseClientQuery reads a query from ?query=... (GET), a
+// JSON body (POST), or a multipart body (POST with files):
+func parseClientQuery(w http.ResponseWriter, r *http.Request) (ClientQuery, error) {
+	var q ClientQuery
+	switch {
+	case r.Method == http.MethodGet:
+		params := r.URL.Query()
+		q.Query = params.Get("query")
+		q.OpName = params.Get("operationName")
+		return q, nil
+	case strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data"):
+		if r.Header.Get("GraphQL-Require-Preflight") == "" {
+			return q, errPreflightRequired
+		}
+		return parseMultipartQuery(w, r)
+	default:
+		// A misspelled key, e.g. "variable", would otherwise be
+		// dropped silently and the query would fail for a
+		// confusing reason. Variables stay an untyped map:
+		// Schema.Exec coerces them against the query’s variable
+		// types itself, so decoding them any further here would
+		// only be done twice.
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&q)
+		return q, err
+	}
+}
+
+var errPreflightRequired = errors.New("multipart requests must set a GraphQL-Require-Preflight header")
+
+// queryErrorMessage turns an error from parseClientQuery into a
+// message for the client. Decoding errors can quote the body
+// back, and multipart ones can name temp files, so the client
+// gets a fixed message per kind of error and the log gets the
+// rest:
+func queryErrorMessage(err error) string {
+	var (
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+		maxBytesErr *http.MaxBytesError
+	)
+	switch {
+	case errors.Is(err, errPreflightRequired):
+		return err.Error()
+	case errors.Is(err, io.EOF):
+		return "request body is empty"
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return "request body is not valid JSON"
+	case errors.As(err, &typeErr):
+		// Field is one of ClientQuery’s, never the client’s:
+		return fmt.Sprintf("%s: expected %s", typeErr.Field, jsonType(typeErr.Type))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return "request body has an unknown field; expected query, operationName, variables, or extensions"
+	case errors.As(err, &maxBytesErr):
+		return "request body is too large"
+	default:
+		return "invalid request body"
+	}
+}
+
+// operationType returns the type of the operation a document
+// runs, "query", "mutation", or "subscription", picking it by
+// opName as graphql-go does. It reads just enough of the
+// document to tell: a keyword or { at the top level starts a
+// definition, and strings, comments, and anything nested are
+// skipped, so e.g. { greet(name: "mutation") } is a query.
+func operationType(document, opName string) (string, error) {
+	type operation struct{ typ, name string }
+	var (
+		ops          []operation
+		depth        int  // Nesting of {} and ().
+		inDefinition bool // Between a keyword and its {.
+		expectName   bool // Right after an operation keyword.
+	)
+	for x := 0; x < len(document); {
+		c := document[x]
+		switch {
+		case c == '#':
+			for x < len(document) && document[x] != '\n' {
+				x++
+			}
+		case strings.HasPrefix(document[x:], `"""`):
+			end := strings.Index(document[x+3:], `"""`)
+			if end < 0 {
+				return "", errors.New("unterminated block string")
+			}
+			x += 3 + end + 3
+		case c == '"':
+			x++
+			for x < len(document) && document[x] != '"' {
+				if document[x] == '\\' {
+					x++
+				}
+				x++
+			}
+			x++
+		case c == '{' || c == '(':
+			if depth == 0 && c == '{' {
+				if !inDefinition {
+					ops = append(ops, operation{typ: "query"})
+				}
+				inDefinition = false
+			}
+			expectName = false
+			depth++
+			x++
+		case c == '}' || c == ')':
+			depth--
+			x++
+		case c == '_' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z':
+			start := x
+			for x < len(document) && (document[x] == '_' || 'A' <= document[x] && document[x] <= 'Z' ||
+				'a' <= document[x] && document[x] <= 'z' || '0' <= document[x] && document[x] <= '9') {
+				x++
+			}
+			name := document[start:x]
+			switch {
+			case depth > 0 || inDefinition && !expectName:
+			case expectName:
+				ops[len(ops)-1].name = name
+				expectName = false
+			case name == "query" || name == "mutation" || name == "subscription":
+				ops = append(ops, operation{typ: name})
+				inDefinition, expectName = true, true
+			default: // fragment, or a type system definition.
+				inDefinition = true
+			}
+		default:
+			x++
+		}
+	}
+	if opName == "" {
+		if len(ops) != 1 {
+			return "", errors.New("operationName is required unless the document has exactly one operation")
+		}
+		return ops[0].typ, nil
+	}
+	for _, op := range ops {
+		if op.name == opName {
+			return op.typ, nil
+		}
+	}
+	return "", fmt.Errorf("no operation named %q", opName)
+}
+
+/*
+ * Typed variables
+ *
+ * Variables arrive as untyped JSON; a client that sends
+ * "note": "hello" instead of "note": {"data": "hello"} only
+ * finds out when the query fails. For known operations, we
+ * decode the variables into a typed struct first and respond
+ * 400 Bad Request with a message per field.
+ */
+
+// Variables validates the fields a typed struct can’t, e.g.
+// required fields:
+type Variables interface {
+	Validate() []string
+}
+
+// OperationVariables maps operation names to their typed
+// variables:
+var OperationVariables = map[string]func() Variables{
+	"CreateNote": func() Variables { return &CreateNoteVariables{} },
+}
+
+type CreateNoteVariables struct {
+	UserID *string `json:"userID"`
+	Note   *struct {
+		Data *string `json:"data"`
+	} `json:"note"`
+}
+
+func (v *CreateNoteVariables) Validate() []string {
+	var messages []string
+	if v.UserID == nil {
+		messages = append(messages, "userID: required")
+	}
+	if v.Note == nil {
+		messages = append(messages, "note: required")
+	} else if v.Note.Data == nil {
+		messages = append(messages, "note.data: required")
+	}
+	return messages
+}
+
+// jsonType names a Go type the way a JSON client would:
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return t.Kind().String()
+	}
+}
+
+// checkVariables returns a message per invalid field, or nil
+// if the variables are valid or the operation is unknown:
+func checkVariables(q ClientQuery) []string {
+	newVariables, ok := OperationVariables[q.OpName]
+	if !ok {
+		return nil
+	}
+	bstr, err := json.Marshal(q.Variables)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	variables := newVariables()
+	dec := json.NewDecoder(bytes.NewReader(bstr))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(variables)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", typeErr.Field, jsonType(typeErr.Type), typeErr.Value)}
+	} else if err != nil {
+		// e.g. json: unknown field "userId"
+		return []string{strings.TrimPrefix(err.Error(), "json: ")}
+	}
+	return variables.Validate()
+}
+
+/*
+ * Request IDs
+ *
+ * withRequestID gives every request an ID: the client’s
+ * X-Request-ID header if it sent one, or a random one. The ID
+ * is echoed in the response header, put in the context, and
+ * prefixed to the handler’s logs, so one request can be
+ * followed from the client through the access log and errors.
+ * GraphQL errors carry it in their extensions, as negotiated
+ * errors do:
+ *
+ * {"message": "...", "extensions": {"requestID": "6a1f0c2e9b8d4f37"}}
+ */
+
+type requestIDKey struct{}
+
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID returns 16 random hex digits:
+func newRequestID() string {
+	bstr := make([]byte, 8)
+	rand.Read(bstr)
+	return hex.EncodeToString(bstr)
+}
+
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Client IDs end up in our logs and headers, so we
+		// bound them; a bad one is replaced, not rejected:
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID allows 1–64 of [A-Za-z0-9._-], which can’t
+// forge a log line or break out of a header:
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// addRequestID adds the request ID to each of resp’s errors’
+// extensions:
+func addRequestID(ctx context.Context, resp *graphql.Response) {
+	id := requestID(ctx)
+	if id == "" {
+		return
+	}
+	for _, err := range resp.Errors {
+		if err.Extensions == nil {
+			err.Extensions = map[string]interface{}{}
+		}
+		err.Extensions["requestID"] = id
+	}
+}
+
+// logf is log.Printf prefixed with the request ID:
+func logf(ctx context.Context, format string, args ...interface{}) {
+	log.Printf("[%s] "+format, append([]interface{}{requestID(ctx)}, args...)...)
+}
+
+/*
+ * Access log
+ *
+ * withAccessLog logs one line per request in Apache’s common
+ * log format, plus the duration:
+ *
+ * 127.0.0.1 - - [16/Oct/2026:18:00:00 +0000] "GET /graphql HTTP/1.1" 200 43 1.2ms 6a1f0c2e9b8d4f37
+ *
+ * The status and byte count aren’t on the request, so we wrap
+ * the ResponseWriter to record them. Lines are written to out,
+ * which can be any writer, e.g. a bytes.Buffer. The last
+ * field is the request ID, if any.
+ */
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the original
+// ResponseWriter, e.g. to flush.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func withAccessLog(next http.Handler, out io.Writer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		fmt.Fprintf(out, "%s - - [%s] \"%s %s %s\" %d %d %s %s\n",
+			host, start.Format("02/Jan/2006:15:04:05 -0700"),
+			r.Method, r.URL.RequestURI(), r.Proto,
+			rw.status, rw.bytes, time.Since(start), requestID(r.Context()),
+		)
+	})
+}
+
+/*
+ * main
+ */
+
+// We can serve over HTTPS by passing a certificate and key:
+//
+// $ go run main-7.go -tls-cert cert.pem -tls-key key.pem
+//
+// When either flag is missing, we fall back to plain HTTP.
+var (
+	tlsCert = flag.String("tls-cert", "", "TLS certificate file")
+	tlsKey  = flag.String("tls-key", "", "TLS key file")
+)
+
+// Anonymous operations all look alike in logs and traces.
+// With -require-operation-name, we reject queries without an
+// operationName, e.g. { greet }, and ask the client to name
+// them, e.g. query Greet { greet }. It’s off by default so
+// the examples above keep working.
+var requireOpName = flag.Bool("require-operation-name", false, "reject anonymous operations")
+
+// At most -max-in-flight queries execute at once. inFlight is
+// a semaphore: a buffered channel we send to before executing
+// and receive from after. When it’s full, we respond 429 Too
+// Many Requests rather than queue requests without bound.
+var (
+	maxInFlight = flag.Int("max-in-flight", 100, "max concurrent queries")
+	inFlight    chan struct{}
+)
+
+// Indentation for printed JSON (see main-2):
+var (
+	IndentPrefix = ""
+	IndentString = "\t"
+)
+
+// Each operation gets -exec-timeout to execute, however long
+// the client is willing to wait, so one slow query can’t tie
+// up the server. Resolvers see the deadline on their
+// context.
+var execTimeout = flag.Duration("exec-timeout", 5*time.Second, "max time to execute an operation")
+
+// execOperation executes the operation, but gives up after
+// timeout. graphql-go doesn’t interrupt a resolver that
+// ignores its context, so Schema.Exec runs in a goroutine and
+// we stop waiting for it at the deadline. The response then
+// has just the “operation timed out” error; the abandoned
+// resolvers finish in the background and their results are
+// dropped. Either way, errors carry the request ID.
+func execOperation(ctx context.Context, schema *graphql.Schema, q ClientQuery, timeout time.Duration) (resp *graphql.Response, timedOut bool) {
+	defer func() { addRequestID(ctx, resp) }()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan *graphql.Response, 1)
+	go func() {
+		done <- schema.Exec(ctx, q.Query, q.OpName, q.Variables)
+	}()
+	select {
+	case resp := <-done:
+		return resp, false
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			// Cancelled, e.g. over budget (see costTracer):
+			// graphql-go stops resolving fields, so Exec
+			// returns promptly.
+			return <-done, false
+		}
+		return &graphql.Response{
+			Errors: []*gqlerrors.QueryError{gqlerrors.Errorf("operation timed out after %s", timeout)},
+		}, true
+	}
+}
+
+// runClient is the client side of this example. It takes the
+// HTTP client and base URL as arguments, so it can be pointed
+// at any server, e.g. an httptest.Server:
+func runClient(client *http.Client, baseURL string) ([]byte, error) {
+	// To perform a query over HTTP, we can use a GET request
+	// and concatenate the query to the ?query= URL parameter.
+	// This is common practice for getting started.
+	queryParam := url.QueryEscape(`{ greet }`)
+	resp, err := client.Get(baseURL + "/graphql?query=" + queryParam)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// clientFor returns a client that trusts the certificate in
+// certFile, so runClient can reach a server using a
+// self-signed certificate. Without a certFile, it’s
+// http.DefaultClient.
+func clientFor(certFile string) (*http.Client, error) {
+	if certFile == "" {
+		return http.DefaultClient, nil
+	}
+	bstr, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bstr) {
+		return nil, fmt.Errorf("%s: no certificates found", certFile)
+	}
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	return &http.Client{Transport: transport}, nil
+}
 
 func main() {
+	flag.Parse()
+	inFlight = make(chan struct{}, *maxInFlight)
+	useTLS := *tlsCert != "" && *tlsKey != ""
+	baseURL, certFile := "http://localhost:8000", ""
+	if useTLS {
+		baseURL, certFile = "https://localhost:8000", *tlsCert
+	}
+
 	// Client-side request; this goroutine simulates a client-
 	// side service, e.g. an app or a service that consumes
 	// this API.
 	//
 	// The reason we’re using a goroutine is so we don’t block
-	// the server from responding to the request.
+	// the server from responding to the request. It’s only a
+	// demo, so when it fails, we log and let the server run.
 	go func() {
-		// To perform a query over HTTP, we can use a GET
-		// request and concatenate the query to the ?query= URL
-		// parameter. This is common practice for getting
-		// started.
-		queryParam := url.QueryEscape(`{ greet }`)
-		resp, err := http.Get("http://localhost:8000/graphql?query=" + queryParam)
+		client, err := clientFor(certFile)
 		if err != nil {
-			panic(err)
+			log.Printf("clientFor: %s", err)
+			return
 		}
-		defer resp.Body.Close()
-		bstr, err := ioutil.ReadAll(resp.Body)
+		bstr, err := runClient(client, baseURL)
 		if err != nil {
-			panic(err)
+			log.Printf("runClient: %s", err)
+			return
 		}
 		fmt.Println(string(bstr))
 		// Expected output:
@@ -121,36 +1256,135 @@ func main() {
 		// }
 	}()
 
-	http.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
-		// This is the GraphQL endpoint (/graphql). It has
-		// several responsibilities:
+	handleGraphQL := func(w http.ResponseWriter, r *http.Request) {
+		// This is the GraphQL endpoint (/graphql, and
+		// /admin/graphql for admins). It has several
+		// responsibilities:
 		//
-		// - Ignore non non-GET request.
-		// - Get the URL’s parameters (to access ?query=...).
+		// - Ignore non-GET and non-POST requests.
+		// - Pick the schema for the path.
+		// - Parse the query from the URL or the body.
+		// - Optionally reject anonymous operations.
+		// - Limit how many queries execute at once, and for
+		//   how long.
 		// - Perform the query against the schema.
 		// - Respond to errors with HTTP status codes.
 		//
-		if r.Method != http.MethodGet {
-			RespondNotFound(w)
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			NegotiateNotFound(w, r)
+			return
+		}
+		schema := Schemas[r.URL.Path]
+		if schema == AdminSchema && !isAdmin(r) {
+			NegotiateUnauthorized(w, r)
+			return
+		}
+		q, err := parseClientQuery(w, r)
+		if err != nil {
+			NegotiateBadRequest(w, r, queryErrorMessage(err))
+			logf(r.Context(), "parseClientQuery: %s", err)
+			return
+		}
+		// Per GraphQL over HTTP, GET is for queries only: a link
+		// or an <img> on another site can make a browser send a
+		// GET, so a mutation there would be a CSRF hole.
+		if r.Method == http.MethodGet {
+			opType, err := operationType(q.Query, q.OpName)
+			if err != nil {
+				NegotiateBadRequest(w, r, err.Error())
+				return
+			}
+			if opType == "mutation" {
+				w.Header().Set("Allow", "POST")
+				NegotiateMethodNotAllowed(w, r, "mutations must be sent with POST")
+				return
+			}
+		}
+		if *requireOpName && q.OpName == "" {
+			NegotiateBadRequest(w, r, "operationName is required; name your operation, e.g. query Greet { greet }")
+			return
+		}
+		messages := checkVariables(q)
+		if len(messages) > 0 {
+			NegotiateBadRequest(w, r, messages...)
+			return
+		}
+		select {
+		case inFlight <- struct{}{}:
+			// Deferred, so the slot is released even if Exec
+			// panics:
+			defer func() { <-inFlight }()
+		default:
+			NegotiateTooManyRequests(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), userIDKey{}, graphql.ID(r.Header.Get("X-User-ID")))
+		ctx, policy := withCachePolicy(ctx)
+		client := costClient(r)
+		if budgets.remaining(client) <= 0 {
+			NegotiateTooManyRequests(w, r, "query cost budget exhausted; try again later")
+			return
+		}
+		ctx, meter := withCost(ctx, client)
+		defer meter.cancel()
+		resp, timedOut := execOperation(ctx, schema, q, *execTimeout)
+		// Every query pays for the fields it resolved, so the
+		// cost headers go out whether or not it succeeded:
+		w.Header().Set("X-GraphQL-Cost", strconv.FormatInt(meter.Cost(), 10))
+		w.Header().Set("X-GraphQL-Cost-Remaining", strconv.Itoa(budgets.remaining(client)))
+		if meter.Exceeded() {
+			NegotiateTooManyRequests(w, r, "query cost exceeds the remaining budget; try again later")
+			return
+		}
+		if timedOut {
+			NegotiateRequestFailed(w, r, resp.Errors[0].Message)
+			logf(r.Context(), "Schema.Exec: %+v", resp.Errors)
 			return
 		}
-		params := r.URL.Query()
-		resp := Schema.Exec(context.Background(), params.Get("query"), "", nil)
 		if len(resp.Errors) > 0 {
-			RespondServerError(w)
-			log.Printf("Schema.Exec: %+v", resp.Errors)
+			NegotiateServerError(w, r)
+			logf(r.Context(), "Schema.Exec: %+v", resp.Errors)
 			return
 		}
-		json, err := json.MarshalIndent(resp, "", "\t")
+		json, err := json.MarshalIndent(resp, IndentPrefix, IndentString)
 		if err != nil {
-			RespondServerError(w)
-			log.Printf("json.MarshalIndent: %s", err)
+			NegotiateServerError(w, r)
+			logf(r.Context(), "json.MarshalIndent: %s", err)
 			return
 		}
+		w.Header().Set("Cache-Control", policy.Header())
 		fmt.Fprint(w, string(json))
-	})
-	err := http.ListenAndServe(":8000", nil)
-	if err != nil {
+	}
+	for path := range Schemas {
+		http.HandleFunc(path, handleGraphQL)
+	}
+
+	srv := &http.Server{Addr: ":8000", Handler: withRequestID(withAccessLog(http.DefaultServeMux, os.Stderr))}
+
+	// Shut down gracefully on interrupt (^C) so in-flight
+	// requests can finish; this works the same for HTTP and
+	// HTTPS:
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Printf("srv.Shutdown: %s", err)
+		}
+	}()
+
+	var err error
+	if useTLS {
+		log.Printf("Serving HTTPS on %s", srv.Addr)
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		log.Printf("Serving HTTP on %s", srv.Addr)
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		panic(err)
 	}
 }
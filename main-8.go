@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// main-4 uses graphql.UseFieldResolvers() while main-5 and
+// main-6 define a resolver per type and use methods as
+// accessors. main-5 says this “affords us more power at the
+// cost of some convenience” — but what does it cost at
+// runtime?
+//
+// This example parses the same schema both ways against the
+// same in-memory data and checks that both produce identical
+// output:
+//
+// $ go run main-8.go
+//
+// The benchmarks, and what they show, are in
+// tests/main-8/benchmark_test.go:
+//
+// $ cd tests
+// $ EXAMPLE_BENCH=. go test -run 'TestExamples/main-8$' -v
+
+const schemaString = `
+	schema {
+		query: Query
+	}
+	type User {
+		userID: ID!
+		username: String!
+		emoji: String!
+		notes: [Note!]!
+	}
+	type Note {
+		noteID: ID!
+		data: String!
+	}
+	type Query {
+		users: [User!]!
+	}
+`
+
+const query = `{
+	users {
+		userID
+		username
+		emoji
+		notes {
+			noteID
+			data
+		}
+	}
+}`
+
+type User struct {
+	UserID   graphql.ID
+	Username string
+	Emoji    string
+	Notes    []*Note
+}
+
+type Note struct {
+	NoteID graphql.ID
+	Data   string
+}
+
+var users = []*User{
+	{
+		UserID:   graphql.ID("u-001"),
+		Username: "nyxerys",
+		Emoji:    "🇵🇹",
+		Notes: []*Note{
+			{NoteID: "n-001", Data: "Olá Mundo!"},
+			{NoteID: "n-002", Data: "Olá novamente, mundo!"},
+			{NoteID: "n-003", Data: "Olá, escuridão!"},
+		},
+	}, {
+		UserID:   graphql.ID("u-002"),
+		Username: "rdnkta",
+		Emoji:    "🇺🇦",
+		Notes: []*Note{
+			{NoteID: "n-004", Data: "Привіт Світ!"},
+			{NoteID: "n-005", Data: "Привіт ще раз, світ!"},
+			{NoteID: "n-006", Data: "Привіт, темрява!"},
+		},
+	}, {
+		UserID:   graphql.ID("u-003"),
+		Username: "username_ZAYDEK",
+		Emoji:    "🇺🇸",
+		Notes: []*Note{
+			{NoteID: "n-007", Data: "Hello, world!"},
+			{NoteID: "n-008", Data: "Hello again, world!"},
+			{NoteID: "n-009", Data: "Hello, darkness!"},
+		},
+	},
+}
+
+/*
+ * Field resolvers (main-4)
+ */
+
+type FieldRootResolver struct{}
+
+func (r *FieldRootResolver) Users() []*User {
+	return users
+}
+
+/*
+ * Method resolvers (main-5)
+ */
+
+type MethodRootResolver struct{}
+
+func (r *MethodRootResolver) Users() []*UserResolver {
+	var userRxs []*UserResolver
+	for _, u := range users {
+		userRxs = append(userRxs, &UserResolver{u})
+	}
+	return userRxs
+}
+
+type UserResolver struct{ u *User }
+
+func (r *UserResolver) UserID() graphql.ID {
+	return r.u.UserID
+}
+
+func (r *UserResolver) Username() string {
+	return r.u.Username
+}
+
+func (r *UserResolver) Emoji() string {
+	return r.u.Emoji
+}
+
+func (r *UserResolver) Notes() []*NoteResolver {
+	var noteRxs []*NoteResolver
+	for _, note := range r.u.Notes {
+		noteRxs = append(noteRxs, &NoteResolver{note})
+	}
+	return noteRxs
+}
+
+type NoteResolver struct{ n *Note }
+
+func (r *NoteResolver) NoteID() graphql.ID {
+	return r.n.NoteID
+}
+
+func (r *NoteResolver) Data() string {
+	return r.n.Data
+}
+
+/*
+ * main
+ */
+
+var (
+	opts         = []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	FieldSchema  = graphql.MustParseSchema(schemaString, &FieldRootResolver{}, opts...)
+	MethodSchema = graphql.MustParseSchema(schemaString, &MethodRootResolver{})
+)
+
+func exec(schema *graphql.Schema) []byte {
+	resp := schema.Exec(context.Background(), query, "", nil)
+	if len(resp.Errors) > 0 {
+		panic(fmt.Sprintf("Schema.Exec: %+v", resp.Errors))
+	}
+	json, err := json.Marshal(resp)
+	if err != nil {
+		panic(err)
+	}
+	return json
+}
+
+func main() {
+	// Confirm both schemas agree before comparing them:
+	field, method := exec(FieldSchema), exec(MethodSchema)
+	if !bytes.Equal(field, method) {
+		panic("field and method resolvers produced different output")
+	}
+	fmt.Println(string(field))
+}
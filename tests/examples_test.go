@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Each main-N.go is its own package main, so they can’t share
+// a module with each other or with these tests. TestExamples
+// copies each example into a scratch module of its own, along
+// with the schema files, the helpers in shared, and the
+// example’s tests from the directory of the same name (e.g.
+// main-6/*_test.go), then vets and tests it there:
+//
+// $ cd tests
+// $ go test
+//
+// The example tests are tagged `example` so this module
+// doesn’t try to build them without their example. Tests that
+// need Postgres skip unless TEST_DATABASE_URL is set (see
+// main-6/main_test.go). Benchmarks run when EXAMPLE_BENCH is
+// set to a -bench pattern, e.g.:
+//
+// $ EXAMPLE_BENCH=. go test -run 'TestExamples/main-8$' -v
+
+// requires are the examples’ dependencies, and the tests’
+// (go mod tidy drops the ones an example doesn’t use):
+const requires = `
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/graph-gophers/graphql-go v1.5.0
+	github.com/lib/pq v1.10.9
+	golang.org/x/sync v0.10.0
+)
+`
+
+func TestExamples(t *testing.T) {
+	examples, err := filepath.Glob("../main-*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, example := range examples {
+		example := example
+		name := strings.TrimSuffix(filepath.Base(example), ".go")
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			copyFile(t, example, filepath.Join(dir, "main.go"))
+			for _, pattern := range []string{"../*.graphql", "../*.sql", "shared/*_test.go", name + "/*_test.go"} {
+				paths, err := filepath.Glob(pattern)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, path := range paths {
+					copyFile(t, path, filepath.Join(dir, filepath.Base(path)))
+				}
+			}
+			goMod := "module example.com/" + name + "\n\ngo 1.22\n" + requires
+			err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			run(t, dir, "go", "mod", "tidy")
+			run(t, dir, "go", "vet", "-tags", "example", ".")
+			run(t, dir, "go", "test", "-tags", "example", "-count", "1", ".")
+			if bench := os.Getenv("EXAMPLE_BENCH"); bench != "" {
+				out := run(t, dir, "go", "test", "-tags", "example", "-run", "^$", "-bench", bench, "-benchmem", ".")
+				t.Logf("%s", out)
+			}
+		})
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	bstr, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dst, bstr, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func run(t *testing.T, dir string, name string, args ...string) []byte {
+	t.Helper()
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s %s: %s\n%s", name, strings.Join(args, " "), err, out)
+	}
+	return out
+}
@@ -0,0 +1,3 @@
+module github.com/zaydek/graphql-go-walkthrough/tests
+
+go 1.22
@@ -0,0 +1,20 @@
+//go:build example
+
+package main
+
+import "testing"
+
+// The schema’s """ descriptions, unlike # comments, come back
+// through introspection:
+func TestDescriptions(t *testing.T) {
+	descriptions := fieldDescriptions(t, testSchema(t), "Query")
+	for field, want := range map[string]string{
+		"users": "List users:",
+		"user":  "Get user:",
+		"note":  "Get note:",
+	} {
+		if got := descriptions[field]; got != want {
+			t.Errorf("%s: got description %q, want %q", field, got, want)
+		}
+	}
+}
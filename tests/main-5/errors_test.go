@@ -0,0 +1,36 @@
+//go:build example
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+func testSchema(t *testing.T) *graphql.Schema {
+	t.Helper()
+	bstr, err := os.ReadFile("./main-5-schema.graphql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := graphql.ParseSchema(string(bstr), &RootResolver{}, graphql.UseStringDescriptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// main-5’s resolvers return nil for unknown IDs, which
+// graphql-go reports as an error for a non-null field:
+func TestUserNotFound(t *testing.T) {
+	execAndExpectError(t, testSchema(t), `{ user(userID: "u-000000") { username } }`, nil,
+		[]interface{}{"user"}, "got nil for non-null")
+}
+
+func TestNoteNotFound(t *testing.T) {
+	execAndExpectError(t, testSchema(t), `query($noteID: ID!) { note(noteID: $noteID) { data } }`,
+		map[string]interface{}{"noteID": "n-000"},
+		[]interface{}{"note"}, "got nil for non-null")
+}
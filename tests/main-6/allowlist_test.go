@@ -0,0 +1,65 @@
+//go:build example
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+func TestGenerateOperationAllowList(t *testing.T) {
+	allowList, err := GenerateOperationAllowList(testSchema(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"query users(includeNotes: Boolean = false): [User!]!",
+		"query user(userID: ID!): User!",
+		"mutation createNote(userID: ID!, note: NoteInput!, dryRun: Boolean = false): Note!",
+	} {
+		found := false
+		for _, sig := range allowList {
+			found = found || sig == want
+		}
+		if !found {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+type matrixResolver struct{}
+
+func (*matrixResolver) Matrix(args struct{ Rows [][][]int32 }) [][][]string { return nil }
+
+func (*matrixResolver) Tensor(args struct{ Rows [][][][]int32 }) [][][][]string { return nil }
+
+// Lists of lists nest wrappers deeper than most fields; seven
+// levels of ofType reach [[[T!]!]!]!, and anything deeper is
+// an error, not a panic:
+func TestGenerateOperationAllowListNested(t *testing.T) {
+	schema := graphql.MustParseSchema(`
+		type Query {
+			matrix(rows: [[[Int!]!]!]!): [[[String!]!]!]!
+		}
+	`, &matrixResolver{})
+	allowList, err := GenerateOperationAllowList(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "query matrix(rows: [[[Int!]!]!]!): [[[String!]!]!]!"
+	if len(allowList) != 1 || allowList[0] != want {
+		t.Errorf("got %q, want %q", allowList, want)
+	}
+
+	schema = graphql.MustParseSchema(`
+		type Query {
+			tensor(rows: [[[[Int!]!]!]!]!): [[[[String!]!]!]!]!
+		}
+	`, &matrixResolver{})
+	_, err = GenerateOperationAllowList(schema)
+	if err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Errorf("got %v, want an error", err)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAllNotesForbiddenForUsers(t *testing.T) {
+	execAndExpectError(t, testSchema(t), `{ allNotes(first: 1) { edges { cursor } } }`, nil,
+		[]interface{}{"allNotes"}, "forbidden")
+}
+
+func TestAllNotesForAdmins(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	ctx := withRole(context.Background(), RoleAdmin)
+	resp := Schema.Exec(ctx, `{ allNotes(first: 1) { edges { cursor } } }`, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	testSchema(t)
+	admin := withRole(context.Background(), RoleAdmin)
+	user := withRole(context.Background(), RoleUser)
+	if err := authorize(admin, "Query.allNotes"); err != nil {
+		t.Errorf("admin: got %v", err)
+	}
+	if err := authorize(user, "Query.allNotes"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("user: got %v, want %v", err, ErrForbidden)
+	}
+	// A field without a role, e.g. a typo, is denied even to
+	// admins:
+	if err := authorize(admin, "Query.allNote"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("unknown field: got %v, want %v", err, ErrForbidden)
+	}
+	FieldRoles = map[string]string{}
+	if err := authorize(admin, "Query.allNotes"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("roles not loaded: got %v, want %v", err, ErrForbidden)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build example
+
+package main
+
+import "testing"
+
+func TestCheckBlocklist(t *testing.T) {
+	for data, want := range map[string]string{
+		"Hello, world!":              "",
+		"An occasional heckler":      "", // near misses: blocked words inside others
+		"casinos":                    "",
+		"What the heck?":             "data: contains blocked words (profanity)",
+		"CASINO night":               "data: contains blocked words (spam)",
+		"Heck, a casino!":            "data: contains blocked words (profanity)",
+		"Casino? Heck!":              "data: contains blocked words (spam)",
+		"darn-it, viagra, and heck.": "data: contains blocked words (profanity)",
+	} {
+		// Map iteration order varies from run to run, so we
+		// check a few times:
+		for i := 0; i < 10; i++ {
+			got := ""
+			if err := checkBlocklist(data); err != nil {
+				got = err.Error()
+			}
+			if got != want {
+				t.Fatalf("checkBlocklist(%q) = %q, want %q", data, got, want)
+			}
+		}
+	}
+}
+
+// A word in two categories is reported under the first, in
+// sorted order:
+func TestCheckBlocklistOverlap(t *testing.T) {
+	saved := Blocklist
+	Blocklist = map[string][]string{"spam": {"heck"}, "profanity": {"heck"}, "abuse": {"darn"}}
+	t.Cleanup(func() { Blocklist = saved })
+	for i := 0; i < 10; i++ {
+		err := checkBlocklist("heck")
+		if err == nil || err.Error() != "data: contains blocked words (profanity)" {
+			t.Fatalf("got %v", err)
+		}
+	}
+}
+
+func TestCreateNoteBlocked(t *testing.T) {
+	execAndExpectError(t, testSchema(t), `mutation { createNote(userID: "u-000000", note: {data: "Visit our casino"}) { noteID } }`, nil,
+		[]interface{}{"createNote"}, "contains blocked words (spam)")
+}
@@ -0,0 +1,41 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func testBreaker(t *testing.T) {
+	t.Helper()
+	saved := DBBreaker
+	DBBreaker = &Breaker{Threshold: 2, Cooldown: time.Minute}
+	t.Cleanup(func() { DBBreaker = saved })
+}
+
+func TestBreakerOpensOnBadConn(t *testing.T) {
+	testBreaker(t)
+	for i := 0; i < 2; i++ {
+		timeQuery(context.Background(), "test", func() error { return driver.ErrBadConn })
+	}
+	if DBBreaker.Allow() != ErrServiceUnavailable {
+		t.Error("breaker still closed")
+	}
+}
+
+// A client giving up isn’t an outage:
+func TestBreakerIgnoresContextErrors(t *testing.T) {
+	testBreaker(t)
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 0)
+		timeQuery(ctx, "test", func() error { return context.DeadlineExceeded })
+		cancel()
+		timeQuery(context.Background(), "test", func() error { return context.Canceled })
+	}
+	if err := DBBreaker.Allow(); err != nil {
+		t.Errorf("breaker opened: %s", err)
+	}
+}
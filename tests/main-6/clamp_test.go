@@ -0,0 +1,49 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClampLimit(t *testing.T) {
+	n := func(n int32) *int32 { return &n }
+	tests := []struct {
+		name      string
+		requested *int32
+		want      int32
+	}{
+		{"nil", nil, 10},
+		{"in range", n(42), 42},
+		{"zero", n(0), 0},
+		{"negative", n(-1), 0},
+		{"over max", n(101), 100},
+	}
+	for _, test := range tests {
+		if got := clampLimit(test.requested, 10, 100); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClampResultsWarns(t *testing.T) {
+	ctx, warnings := withWarnings(context.Background())
+	over := int32(101)
+	if got := clampResults(ctx, "limit", &over, 10, 100); got != 100 {
+		t.Errorf("got %d, want 100", got)
+	}
+	// The default isn’t the client’s doing, so it isn’t worth a
+	// warning:
+	if got := clampResults(ctx, "limit", nil, 10, 100); got != 10 {
+		t.Errorf("got %d, want 10", got)
+	}
+	if len(warnings.list) != 1 || warnings.list[0] != "limit: clamped 101 to 100 results" {
+		t.Errorf("got warnings %v", warnings.list)
+	}
+}
+
+func TestHistogramBucketsMustBePositive(t *testing.T) {
+	execAndExpectError(t, testSchema(t), `{ noteLengthHistogram(buckets: 0) { count } }`, nil,
+		[]interface{}{"noteLengthHistogram"}, "buckets: must be positive")
+}
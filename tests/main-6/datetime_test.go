@@ -0,0 +1,47 @@
+//go:build example
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// A DateTime variable is a plain string, which UnmarshalGraphQL
+// parses before the resolver runs. Since it’s in the future,
+// the resolver rejects it, which it can only do if it got the
+// parsed time:
+func TestDateTimeVariable(t *testing.T) {
+	since := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	execAndExpectError(t, testSchema(t), `query($since: DateTime!) { notesModifiedSince(userID: "u-000000", since: $since) { noteID } }`,
+		map[string]interface{}{"since": since},
+		[]interface{}{"notesModifiedSince"}, "since: must not be in the future")
+}
+
+// A bad DateTime variable fails the request with
+// UnmarshalGraphQL’s error, before any resolver runs:
+func TestInvalidDateTimeVariable(t *testing.T) {
+	for _, since := range []interface{}{"yesterday", "2019-08-01", 1564660800} {
+		execAndExpectError(t, testSchema(t), `query($since: DateTime!) { notesModifiedSince(userID: "u-000000", since: $since) { noteID } }`,
+			map[string]interface{}{"since": since},
+			nil, "DateTime: ")
+	}
+}
+
+// Fractional seconds survive the round trip, so a timestamp
+// the server sent can be sent back as a cursor:
+func TestDateTimeRoundTrip(t *testing.T) {
+	want := time.Date(2019, 8, 1, 12, 0, 0, 123456000, time.UTC)
+	bstr, err := DateTime{want}.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bstr) != `"2019-08-01T12:00:00.123456Z"` {
+		t.Errorf("got %s", bstr)
+	}
+	var got DateTime
+	err = got.UnmarshalGraphQL("2019-08-01T12:00:00.123456Z")
+	if err != nil || !got.Equal(want) {
+		t.Errorf("got %v, %v; want %v", got, err, want)
+	}
+}
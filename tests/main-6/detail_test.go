@@ -0,0 +1,95 @@
+//go:build example
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/lib/pq"
+)
+
+// captureLog sends the log to a buffer for the rest of the
+// test:
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func withDebugErrors(t *testing.T, debug bool) {
+	t.Helper()
+	saved := DebugErrors
+	DebugErrors = debug
+	t.Cleanup(func() { DebugErrors = saved })
+}
+
+const secret = `relation "note_tags" does not exist`
+
+// Clients see the detail only with DebugErrors; the log always
+// has it:
+func TestErrorDetail(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		withDebugErrors(t, debug)
+		logged := captureLog(t)
+		pqErr := &pq.Error{Code: "42P01", Message: secret}
+		resp := &graphql.Response{Errors: []*gqlerrors.QueryError{
+			{Message: pqErr.Error(), ResolverError: pqErr, Path: []interface{}{"note", "tags"}},
+			{Message: "limit: must not be negative", ResolverError: &ValidationError{Field: "limit", Message: "must not be negative"}},
+		}}
+		sanitizeErrors(resp)
+		internal, public := resp.Errors[0], resp.Errors[1]
+		if debug && (!strings.Contains(internal.Message, secret) || internal.Extensions["sqlState"] != "42P01") {
+			t.Errorf("debug: got %q %v, want the detail", internal.Message, internal.Extensions)
+		}
+		if !debug && (internal.Message != "internal error" || internal.Extensions["code"] != "INTERNAL") {
+			t.Errorf("got %q %v, want it sanitized", internal.Message, internal.Extensions)
+		}
+		if public.Message != "limit: must not be negative" {
+			t.Errorf("debug %t: validation error changed to %q", debug, public.Message)
+		}
+		if !strings.Contains(logged.String(), secret) || strings.Contains(logged.String(), "limit") {
+			t.Errorf("debug %t: got log %q, want only the internal error in full", debug, logged)
+		}
+	}
+}
+
+// Subscription results go through sanitizeErrors too:
+func TestSSEErrorDetail(t *testing.T) {
+	testSchema(t)
+	withDebugErrors(t, false)
+	captureLog(t)
+	db, mock := mockDB(t)
+	DB = db
+	t.Cleanup(func() { DB = nil })
+	mock.ExpectQuery("FROM note_tags").WillReturnError(&pq.Error{Code: "42P01", Message: secret})
+
+	srv := httptest.NewServer(http.HandlerFunc(handleSSE))
+	defer srv.Close()
+	query := url.QueryEscape(`subscription { noteCreated { note { tags } } }`)
+	resp, err := http.Get(srv.URL + "?query=" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	broker.Publish("u-1", &Note{NoteID: "n-1"})
+	lines := bufio.NewScanner(resp.Body)
+	var frame string
+	for lines.Scan() && lines.Text() != "" {
+		frame += lines.Text() + "\n"
+	}
+	if !strings.Contains(frame, "internal error") || strings.Contains(frame, "note_tags") {
+		t.Errorf("got frame %q, want the error sanitized", frame)
+	}
+}
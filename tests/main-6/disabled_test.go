@@ -0,0 +1,63 @@
+//go:build example
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func withDisabled(t *testing.T, list string) {
+	t.Helper()
+	saved := DisabledMutations
+	DisabledMutations = loadDisabledMutations(list)
+	t.Cleanup(func() { DisabledMutations = saved })
+}
+
+func TestLoadDisabledMutations(t *testing.T) {
+	got := loadDisabledMutations(" createNote,, deleteUser ")
+	want := map[string]bool{"createNote": true, "deleteUser": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDisabledMutation(t *testing.T) {
+	withDisabled(t, "createUser")
+	execAndExpectError(t, testSchema(t), `mutation { createUser(username: "disabled", emoji: "🇵🇹") { userID } }`, nil,
+		[]interface{}{"createUser"}, "operation disabled: createUser")
+}
+
+// createUser isn’t disabled, so it gets as far as checking
+// its input, which fails before it touches the database:
+func TestEnabledMutation(t *testing.T) {
+	withDisabled(t, "createNote")
+	execAndExpectError(t, testSchema(t), `mutation { createUser(username: "enabled", emoji: "x") { userID } }`, nil,
+		[]interface{}{"createUser"}, "emoji: ")
+}
+
+func TestDisabledMutationOverHTTP(t *testing.T) {
+	testSchema(t)
+	withDisabled(t, "createUser")
+	w := httptest.NewRecorder()
+	handleGraphQL(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(
+		`{"query": "mutation { createUser(username: \"disabled\", emoji: \"🇵🇹\") { userID } }"}`,
+	)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "operation disabled") {
+		t.Errorf("got %d %s, want 400 and the error", w.Code, w.Body)
+	}
+}
+
+func TestDisabledImport(t *testing.T) {
+	withDisabled(t, "importNotes")
+	w := httptest.NewRecorder()
+	handleImportNotes(w, httptest.NewRequest("POST", "/import/notes", strings.NewReader(
+		`{"userID":"u-000000","data":"Hello, world!"}`,
+	)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400", w.Code)
+	}
+}
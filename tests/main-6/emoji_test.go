@@ -0,0 +1,42 @@
+//go:build example
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeEmoji(t *testing.T) {
+	for input, want := range map[string]string{
+		"🇵🇹":             "🇵🇹",
+		" 🇺🇦\n":          "🇺🇦",
+		"🇺🇸\uFE0F":       "🇺🇸",
+		"\uFE0F🇺\uFE0F🇳": "🇺🇳",
+		"🇪🇺":             "🇪🇺",
+	} {
+		got, err := normalizeEmoji(input)
+		if err != nil || got != want {
+			t.Errorf("normalizeEmoji(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{
+		"",
+		"pt",             // letters, not a flag
+		"PT",             // likewise
+		"🇵t",             // half a flag and a letter
+		"🇵",              // half a flag
+		"🇵🇹🇺",            // a flag and a half
+		"🇵🇹🇺🇦",           // two flags
+		"🇦🇦",             // a pair that isn’t a region
+		"🇽🇽",             // likewise
+		"🙂",              // not a flag
+		"🏳\uFE0F\u200D🌈", // a flag, but not a region’s
+	} {
+		_, err := normalizeEmoji(input)
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || validationErr.Field != "emoji" {
+			t.Errorf("normalizeEmoji(%q): got %v, want an emoji ValidationError", input, err)
+		}
+	}
+}
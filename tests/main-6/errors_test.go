@@ -0,0 +1,27 @@
+//go:build example
+
+package main
+
+import "testing"
+
+func TestNegativeLimit(t *testing.T) {
+	execAndExpectError(t, testSchema(t), `{ notes(userID: "u-000000", limit: -1) { noteID } }`, nil,
+		[]interface{}{"notes"}, "limit: must not be negative")
+}
+
+func TestEmptyFilter(t *testing.T) {
+	execAndExpectError(t, testSchema(t), `{ filterNotes(filter: {}) { noteID } }`, nil,
+		[]interface{}{"filterNotes"}, "filter: must set at least one field")
+}
+
+func TestInvalidRegex(t *testing.T) {
+	execAndExpectError(t, testSchema(t), `query($pattern: String!) { matchNotes(userID: "u-000000", pattern: $pattern) { noteID } }`,
+		map[string]interface{}{"pattern": "("},
+		[]interface{}{"matchNotes"}, "pattern: invalid regex")
+}
+
+func TestUserNotFound(t *testing.T) {
+	testDB(t)
+	execAndExpectError(t, testSchema(t), `{ user(userID: "u-000000") { username } }`, nil,
+		[]interface{}{"user"}, "user not found")
+}
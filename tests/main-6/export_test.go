@@ -0,0 +1,103 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+func TestExportToken(t *testing.T) {
+	ExportTokenSecret = []byte("secret")
+	defer func() { ExportTokenSecret = nil }()
+	now := time.Now()
+
+	token := signExportToken("u-123abc", now.Add(time.Minute))
+	userID, err := verifyExportToken(token, now)
+	if err != nil || userID != "u-123abc" {
+		t.Errorf("valid token: got %q, %v", userID, err)
+	}
+
+	expired := signExportToken("u-123abc", now.Add(-time.Second))
+	_, err = verifyExportToken(expired, now)
+	if !errors.Is(err, ErrExpiredExportToken) {
+		t.Errorf("expired token: got %v", err)
+	}
+
+	// Swap in another user’s payload but keep the signature:
+	_, sig, _ := strings.Cut(token, ".")
+	payload, _, _ := strings.Cut(signExportToken("u-456def", now.Add(time.Minute)), ".")
+	_, err = verifyExportToken(payload+"."+sig, now)
+	if !errors.Is(err, ErrInvalidExportToken) {
+		t.Errorf("tampered token: got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	handleExportNotes(w, httptest.NewRequest("GET", "/export/notes?token="+payload+"."+sig, nil))
+	if w.Code != StatusCodeForbidden {
+		t.Errorf("tampered token: got status %d, want %d", w.Code, StatusCodeForbidden)
+	}
+}
+
+func TestExportTokenRequiresAdmin(t *testing.T) {
+	ExportTokenSecret = []byte("secret")
+	defer func() { ExportTokenSecret = nil }()
+	ctx := withRole(context.Background(), RoleUser)
+	_, err := (&MutationResolver{}).ExportToken(ctx, struct{ UserID graphql.ID }{"u-123abc"})
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("got %v, want %v", err, ErrForbidden)
+	}
+}
+
+func TestExportRequiresTokenOrAdmin(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "key")
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/export/notes?userID=u-123abc", nil),
+		func() *http.Request {
+			r := httptest.NewRequest("GET", "/export/notes?userID=u-123abc", nil)
+			r.Header.Set("Authorization", "Bearer wrong")
+			return r
+		}(),
+	} {
+		w := httptest.NewRecorder()
+		handleExportNotes(w, r)
+		if w.Code != StatusCodeForbidden {
+			t.Errorf("%s: got status %d, want %d", r.Header.Get("Authorization"), w.Code, StatusCodeForbidden)
+		}
+	}
+}
+
+// A second export that sends back the first’s ETag gets 304:
+func TestExportNotModified(t *testing.T) {
+	testDB(t)
+	t.Setenv("ADMIN_API_KEY", "key")
+	var userID string
+	err := DB.QueryRow(`SELECT user_id FROM users LIMIT 1`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := func(etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/export/notes?userID="+userID, nil)
+		r.Header.Set("Authorization", "Bearer key")
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		handleExportNotes(w, r)
+		return w
+	}
+	first := export("")
+	if first.Code != StatusCodeOK || first.Header().Get("ETag") == "" {
+		t.Fatalf("got status %d, ETag %q", first.Code, first.Header().Get("ETag"))
+	}
+	if second := export(first.Header().Get("ETag")); second.Code != http.StatusNotModified {
+		t.Errorf("got status %d, want %d", second.Code, http.StatusNotModified)
+	}
+}
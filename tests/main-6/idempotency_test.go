@@ -0,0 +1,72 @@
+//go:build example
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestHash(t *testing.T) {
+	a, _ := requestHash(ClientQuery{Query: "mutation { reseed }", Variables: JSON{"a": 1, "b": 2}})
+	b, _ := requestHash(ClientQuery{Query: "mutation { reseed }", Variables: JSON{"b": 2, "a": 1}})
+	c, _ := requestHash(ClientQuery{Query: "mutation { reseed }", Variables: JSON{"a": 2, "b": 2}})
+	if a != b {
+		t.Error("equal requests hash differently")
+	}
+	if a == c {
+		t.Error("different variables hash alike")
+	}
+}
+
+func postGraphQL(t *testing.T, body, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	r.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	handleGraphQL(w, r)
+	return w
+}
+
+func TestIdempotentCreateNote(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	var userID string
+	err := DB.QueryRow(`SELECT user_id FROM users LIMIT 1`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	countNotes := func() int {
+		var n int
+		err := DB.QueryRow(`SELECT count(*) FROM notes WHERE user_id = $1`, userID).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	key := "test-" + t.Name()
+	_, err = DB.Exec(`DELETE FROM idempotency_keys WHERE key = $1`, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"query": "mutation($userID: ID!) { createNote(userID: $userID, note: {data: \"Hello, retry!\"}) { noteID } }", "variables": {"userID": "` + userID + `"}}`
+
+	before := countNotes()
+	first := postGraphQL(t, body, key)
+	second := postGraphQL(t, body, key)
+	if first.Code != StatusCodeOK || second.Code != StatusCodeOK {
+		t.Fatalf("got statuses %d and %d: %s", first.Code, second.Code, second.Body)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("retry got %s, want %s", second.Body, first.Body)
+	}
+	if after := countNotes(); after != before+1 {
+		t.Errorf("created %d notes, want 1", after-before)
+	}
+
+	other := strings.Replace(body, "Hello, retry!", "Hello, other!", 1)
+	if w := postGraphQL(t, other, key); w.Code != StatusCodeUnprocessable {
+		t.Errorf("reused key: got status %d, want %d", w.Code, StatusCodeUnprocessable)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// A line over MaxImportLineSize is reported like any other
+// bad line, and the import carries on past it:
+func TestImportLongLine(t *testing.T) {
+	db, mock := mockDB(t)
+	DB = db
+	t.Cleanup(func() { DB = nil })
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT import_line").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO notes").WithArgs("u-1", "after").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT import_line").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	long := `{"userID":"u-1","data":"` + strings.Repeat("x", MaxImportLineSize) + `"}`
+	body := strings.Join([]string{long, `{"data":"no user"}`, ``, `{"userID":"u-1","data":"after"}`}, "\n")
+	summary, err := importNotes(context.Background(), strings.NewReader(body), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &importSummary{Created: 1, Failed: 2, Errors: []importError{
+		{1, "line is longer than 1048576 bytes"},
+		{2, "userID is required"},
+	}}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("got %+v, want %+v", summary, want)
+	}
+}
+
+func TestImportLongLineStopOnError(t *testing.T) {
+	long := strings.Repeat("x", MaxImportLineSize+1)
+	summary, err := importNotes(context.Background(), strings.NewReader(long+"\n"+`{"userID":"u-1","data":"after"}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Created != 0 || summary.Failed != 1 || len(summary.Errors) != 1 || summary.Errors[0].Line != 1 {
+		t.Errorf("got %+v, want it to stop at line 1", summary)
+	}
+}
@@ -0,0 +1,74 @@
+//go:build example
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func withDuration(t *testing.T, flag *time.Duration, d time.Duration) {
+	t.Helper()
+	saved := *flag
+	*flag = d
+	t.Cleanup(func() { *flag = saved })
+}
+
+// A client that gets no results is pinged, then completed and
+// disconnected after the idle timeout, and its subscription is
+// gone from the broker:
+func TestSSEIdleTimeout(t *testing.T) {
+	testSchema(t)
+	withDuration(t, sseKeepAlive, 20*time.Millisecond)
+	withDuration(t, sseIdleTimeout, 100*time.Millisecond)
+	srv := httptest.NewServer(http.HandlerFunc(handleSSE))
+	defer srv.Close()
+	query := url.QueryEscape(`subscription { noteCreated { note { data } } }`)
+	resp, err := http.Get(srv.URL + "?query=" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := bufio.NewScanner(resp.Body)
+	var pings int
+	var events []string
+	for lines.Scan() {
+		switch lines.Text() {
+		case ": ping":
+			pings++
+		case "":
+		default:
+			events = append(events, lines.Text())
+		}
+	}
+	if lines.Err() != nil && lines.Err() != io.EOF {
+		t.Fatal(lines.Err())
+	}
+	if pings == 0 {
+		t.Error("got no pings")
+	}
+	if want := []string{"event: complete", "data:"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("got %q, want only %q", events, want)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		broker.mu.Lock()
+		subs := len(broker.subs)
+		broker.mu.Unlock()
+		if subs == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscriptions left after the idle timeout", subs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
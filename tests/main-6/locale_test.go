@@ -0,0 +1,45 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocaleFor(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", "EN"},
+		{"pt-PT,pt;q=0.9,en;q=0.8", "PT"},
+		{"en;q=0.5,uk;q=0.9", "UK"},
+		{"pt;q=0,en;q=0.1", "EN"},
+		{"uk;q=0", "EN"},
+		{"fr,pt;q=0.3,uk;q=0.3", "PT"},
+		{"pt;q=abc,uk;q=0.2", "UK"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/graphql", nil)
+		r.Header.Set("Accept-Language", test.acceptLanguage)
+		if got := localeFor(r); got != test.want {
+			t.Errorf("localeFor(%q) = %s, want %s", test.acceptLanguage, got, test.want)
+		}
+	}
+}
+
+func TestLocalizedError(t *testing.T) {
+	for locale, want := range map[string]string{
+		"EN": "user not found",
+		"PT": "utilizador não encontrado",
+		"UK": "користувача не знайдено",
+		"FR": "user not found",
+	} {
+		err := localizedError(withLocale(context.Background(), locale), CodeUserNotFound)
+		if err.Error() != want {
+			t.Errorf("%s: got %q, want %q", locale, err.Error(), want)
+		}
+	}
+}
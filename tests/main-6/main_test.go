@@ -0,0 +1,52 @@
+//go:build example
+
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// testSchema parses the schema the way main does and sets
+// Schema, so tests can go through Exec as well:
+func testSchema(t *testing.T) *graphql.Schema {
+	t.Helper()
+	bstr, err := os.ReadFile("./main-6-schema.graphql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Schema, err = graphql.ParseSchema(string(bstr), &RootResolver{}, graphql.UseStringDescriptions(), graphql.Tracer(statsTracer{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	FieldRoles = loadFieldRoles(Schema)
+	AvailableOperations = loadOperations(Schema)
+	return Schema
+}
+
+// testDB connects to TEST_DATABASE_URL, which must be a
+// scratch database loaded from main-6-schema.sql; tests may
+// write to it. Without it, the test is skipped.
+func testDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	DB, ReplicaDB = db, nil
+	t.Cleanup(func() {
+		db.Close()
+		DB = nil
+	})
+}
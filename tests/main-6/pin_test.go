@@ -0,0 +1,75 @@
+//go:build example
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPinNote(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	var userID string
+	err := DB.QueryRow(`INSERT INTO users (username, emoji) VALUES ('pintest', '🇵🇹') RETURNING user_id`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DB.Exec(`DELETE FROM users WHERE user_id = $1`, userID) })
+	var noteIDs []string
+	for i := 0; i <= *maxPinnedNotes; i++ {
+		var noteID string
+		err := DB.QueryRow(`INSERT INTO notes (user_id, data) VALUES ($1, $2) RETURNING note_id`,
+			userID, fmt.Sprintf("Hello, note %d!", i)).Scan(&noteID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = DB.Exec(`INSERT INTO note_tags (note_id, tag) VALUES ($1, 'pin')`, noteID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		noteIDs = append(noteIDs, noteID)
+	}
+
+	// Pin the notes last to first, up to the limit:
+	pin := `mutation($noteID: ID!) { pinNote(noteID: $noteID, pinned: true) { noteID } }`
+	for i := len(noteIDs) - 1; i > 0; i-- {
+		var pinned struct{ PinNote struct{ NoteID string } }
+		execData(t, pin, map[string]interface{}{"noteID": noteIDs[i]}, &pinned)
+	}
+	execAndExpectError(t, Schema, pin, map[string]interface{}{"noteID": noteIDs[0]},
+		[]interface{}{"pinNote"}, fmt.Sprintf("at most %d notes can be pinned", *maxPinnedNotes))
+
+	// Every list puts the pinned notes first, in position
+	// order, then the rest:
+	want := append(append([]string{}, noteIDs[1:]...), noteIDs[0])
+	var data struct {
+		Notes         []struct{ NoteID string }
+		MatchNotes    []struct{ NoteID string }
+		NotesWithTags []struct{ NoteID string }
+		User          struct {
+			NotePages struct{ Items []struct{ NoteID string } }
+		}
+	}
+	execData(t, `query($userID: ID!) {
+		notes(userID: $userID) { noteID }
+		matchNotes(userID: $userID, pattern: "Hello") { noteID }
+		notesWithTags(userID: $userID, tags: ["pin"]) { noteID }
+		user(userID: $userID) { notePages { items { noteID } } }
+	}`, map[string]interface{}{"userID": userID}, &data)
+	for name, notes := range map[string][]struct{ NoteID string }{
+		"notes":         data.Notes,
+		"matchNotes":    data.MatchNotes,
+		"notesWithTags": data.NotesWithTags,
+		"notePages":     data.User.NotePages.Items,
+	} {
+		var got []string
+		for _, note := range notes {
+			got = append(got, note.NoteID)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
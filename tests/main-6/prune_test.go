@@ -0,0 +1,62 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// An archived note is pruned by when it was archived: editing
+// it since doesn’t keep it, and unarchiving it does.
+func TestPruneArchivedNotes(t *testing.T) {
+	testDB(t)
+	var userID string
+	err := DB.QueryRow(`INSERT INTO users (username, emoji) VALUES ('prunetest', '🇵🇹') RETURNING user_id`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DB.Exec(`DELETE FROM users WHERE user_id = $1`, userID) })
+	insert := func(data, status string) (noteID string) {
+		t.Helper()
+		err := DB.QueryRow(`INSERT INTO notes (user_id, data, status) VALUES ($1, $2, $3) RETURNING note_id`,
+			userID, data, status).Scan(&noteID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return noteID
+	}
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		_, err := DB.Exec(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := insert("archived long ago, edited today", "ARCHIVED")
+	exec(`UPDATE notes SET archived_at = now() - interval '40 days' WHERE note_id = $1`, old)
+	exec(`UPDATE notes SET data = 'edited' WHERE note_id = $1`, old)
+	recent := insert("archived today", "ARCHIVED")
+	unarchived := insert("unarchived", "ARCHIVED")
+	exec(`UPDATE notes SET archived_at = now() - interval '40 days' WHERE note_id = $1`, unarchived)
+	exec(`UPDATE notes SET status = 'PUBLISHED' WHERE note_id = $1`, unarchived)
+
+	pruned, err := pruneArchivedNotes(context.Background(), 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Errorf("pruned %d notes, want 1", pruned)
+	}
+	for noteID, want := range map[string]bool{old: false, recent: true, unarchived: true} {
+		var exists bool
+		err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM notes WHERE note_id = $1)`, noteID).Scan(&exists)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != want {
+			t.Errorf("%s: exists is %t, want %t", noteID, exists, want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Queries read from the replica and mutations write to the
+// primary; mockDB fails the test if either sees the other’s
+// queries:
+func TestReadsUseReplica(t *testing.T) {
+	testSchema(t)
+	primary, primaryMock := mockDB(t)
+	replica, replicaMock := mockDB(t)
+	DB, ReplicaDB = primary, replica
+	t.Cleanup(func() { DB, ReplicaDB = nil, nil })
+
+	replicaMock.ExpectQuery("FROM users").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "emoji"}).AddRow("u-1", "zaydek", "🇵🇹"))
+	resp := Schema.Exec(context.Background(), `{ users { username } }`, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectQuery("INSERT INTO users").WithArgs("replicatest", "🇵🇹").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "emoji"}).AddRow("u-2", "replicatest", "🇵🇹"))
+	primaryMock.ExpectCommit()
+	resp = Schema.Exec(context.Background(), `mutation { createUser(username: "replicatest", emoji: "🇵🇹") { userID } }`, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+}
+
+func TestReadDBFallsBackToPrimary(t *testing.T) {
+	primary, _ := mockDB(t)
+	DB, ReplicaDB = primary, nil
+	t.Cleanup(func() { DB = nil })
+	if ReadDB() != primary {
+		t.Error("ReadDB isn’t the primary without a replica")
+	}
+}
@@ -0,0 +1,32 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// Reseed should load the same tags main-6-schema.sql does:
+func TestReseedTags(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	t.Setenv("ALLOW_RESEED", "true")
+	ctx := withRole(context.Background(), RoleAdmin)
+	resp := Schema.Exec(ctx, `mutation { reseed }`, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	// ~* folds Cyrillic case only in some locales, so "Світ"
+	// may not count as "world":
+	for tag, want := range map[string]int{"world": 5, "again": 3, "darkness": 3} {
+		var got int
+		err := DB.QueryRow(`SELECT count(*) FROM note_tags WHERE tag = $1`, tag).Scan(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got < want {
+			t.Errorf("%s: got %d notes, want at least %d", tag, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// withMaxResults lowers MaxResults for the test, so the mock
+// data goes over the cap:
+func withMaxResults(t *testing.T, n int32) {
+	t.Helper()
+	saved := MaxResults
+	MaxResults = n
+	t.Cleanup(func() { MaxResults = saved })
+}
+
+func TestResultsOverCap(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	withMaxResults(t, 2)
+	var userID string
+	err := DB.QueryRow(`SELECT user_id FROM users WHERE username = 'zaydek'`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query       string
+		wantWarning string
+	}{
+		{`query($userID: ID!) { notes(userID: $userID, limit: 5) { noteID } }`, "limit: clamped 5 to 2 results"},
+		{`query($userID: ID!) { maybeNotes(userID: $userID) { noteID } }`, "notes: truncated to 2 results"},
+		{`{ users { username } }`, "users: truncated to 2 results"},
+	}
+	for _, test := range tests {
+		resp := Exec(context.Background(), ClientQuery{Query: test.query, Variables: JSON{"userID": userID}})
+		if len(resp.Errors) > 0 {
+			t.Fatal(resp.Errors)
+		}
+		warnings, _ := resp.Extensions["warnings"].([]string)
+		if !reflect.DeepEqual(warnings, []string{test.wantWarning}) {
+			t.Errorf("%s: got warnings %v, want %q", test.query, warnings, test.wantWarning)
+		}
+	}
+}
+
+func TestCapResults(t *testing.T) {
+	withMaxResults(t, 2)
+	ctx, warnings := withWarnings(context.Background())
+	if n := capResults(ctx, "users", 2); n != 2 || len(warnings.list) != 0 {
+		t.Errorf("at the cap: got %d, warnings %v", n, warnings.list)
+	}
+	if n := capResults(ctx, "users", 3); n != 2 || len(warnings.list) != 1 {
+		t.Errorf("over the cap: got %d, warnings %v", n, warnings.list)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// When one search fails, the other is cancelled rather than
+// left to run to completion for results that are thrown away:
+func TestGlobalSearchCancelsSibling(t *testing.T) {
+	db, mock := mockDB(t)
+	DB = db
+	t.Cleanup(func() { DB = nil })
+	mock.MatchExpectationsInOrder(false)
+	failed := errors.New("users: connection reset")
+	mock.ExpectQuery("FROM users").WillReturnError(failed)
+	mock.ExpectQuery("FROM notes").WillDelayFor(10 * time.Second).WillReturnRows(sqlmock.NewRows([]string{"note_id"}))
+
+	start := time.Now()
+	_, err := (&QueryResolver{}).GlobalSearch(context.Background(), struct{ Query string }{"hello"})
+	if !errors.Is(err, failed) {
+		t.Errorf("got %v, want the users search’s error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s, want the notes search cancelled", elapsed)
+	}
+}
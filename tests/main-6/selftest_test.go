@@ -0,0 +1,30 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/graph-gophers/graphql-go/types"
+)
+
+// Every root query field needs a self-test query, or selfTest
+// fails after the next deploy:
+func TestSelfTestQueries(t *testing.T) {
+	testSchema(t)
+	queryType := Schema.ASTSchema().EntryPoints["query"].(*types.ObjectTypeDefinition)
+	for _, field := range queryType.Fields {
+		if _, ok := SelfTestQueries[field.Name]; !ok {
+			t.Errorf("%s has no self-test query", field.Name)
+		}
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	if !selfTest(context.Background()) {
+		t.Error("selfTest failed on the seed data; see the log")
+	}
+}
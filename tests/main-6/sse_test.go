@@ -0,0 +1,41 @@
+//go:build example
+
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// handleSSE subscribes before it sends the headers, so once
+// Get returns, a new note is streamed as a frame:
+func TestSSE(t *testing.T) {
+	testSchema(t)
+	srv := httptest.NewServer(http.HandlerFunc(handleSSE))
+	defer srv.Close()
+	query := url.QueryEscape(`subscription { noteCreated { note { data } } }`)
+	resp, err := http.Get(srv.URL + "?query=" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("got Content-Type %q", got)
+	}
+
+	// createNote publishes the note it created:
+	broker.Publish("u-1", &Note{NoteID: "n-1", Data: "Hello, world!"})
+	lines := bufio.NewScanner(resp.Body)
+	var frame []string
+	for lines.Scan() && lines.Text() != "" {
+		frame = append(frame, lines.Text())
+	}
+	want := []string{"event: next", `data: {"data":{"noteCreated":{"note":{"data":"Hello, world!"}}}}`}
+	if strings.Join(frame, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got frame %q, want %q", frame, want)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStatsForNestedQuery(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	resp := Exec(context.Background(), ClientQuery{Query: `{ users { username notes { data } } }`})
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	stats, ok := resp.Extensions["stats"].(JSON)
+	if !ok {
+		t.Fatalf("got extensions %v, want stats", resp.Extensions)
+	}
+	// At least users, and each user’s username and notes:
+	if calls, _ := stats["resolverCalls"].(int); calls < 4 {
+		t.Errorf("got %v resolver calls, want at least 4", stats["resolverCalls"])
+	}
+	if queries, _ := stats["dbQueries"].(int); queries < 1 {
+		t.Errorf("got %v queries, want at least 1", stats["dbQueries"])
+	}
+}
@@ -0,0 +1,34 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+func TestSubscriptionIDs(t *testing.T) {
+	b := &Broker{subs: map[graphql.ID]*subscriber{}}
+	events := b.Subscribe(context.Background(), nil)
+	b.Publish("u-1", &Note{NoteID: "n-1"})
+	event := <-events
+	id := event.SubscriptionID()
+	if !strings.HasPrefix(string(id), "s-") || len(id) != len("s-")+32 {
+		t.Errorf("got ID %q, want s- and 32 hex digits", id)
+	}
+	if b.Unsubscribe("s-1") {
+		t.Error("unsubscribed a guessed ID")
+	}
+	if !b.Unsubscribe(id) {
+		t.Error("couldn’t unsubscribe")
+	}
+	if _, ok := <-events; ok {
+		t.Error("events still open after unsubscribe")
+	}
+	if b.Unsubscribe(id) {
+		t.Error("unsubscribed twice")
+	}
+}
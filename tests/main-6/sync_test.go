@@ -0,0 +1,87 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// syncNotes runs notesModifiedSince and returns the notes and
+// any warnings:
+func syncNotes(t *testing.T, vars JSON) ([]syncedNote, []string) {
+	t.Helper()
+	resp := Exec(context.Background(), ClientQuery{
+		Query: `query($userID: ID!, $since: DateTime!, $afterNoteID: ID) {
+			notesModifiedSince(userID: $userID, since: $since, afterNoteID: $afterNoteID) { noteID data updatedAt }
+		}`,
+		Variables: vars,
+	})
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	var data struct{ NotesModifiedSince []syncedNote }
+	err := json.Unmarshal(resp.Data, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings, _ := resp.Extensions["warnings"].([]string)
+	return data.NotesModifiedSince, warnings
+}
+
+type syncedNote struct {
+	NoteID    string
+	Data      string
+	UpdatedAt string
+}
+
+// Notes inserted in one statement share an updated_at, so a
+// page boundary falls between notes that tie; the cursor must
+// pick up where the page left off without skipping any:
+func TestNotesModifiedSince(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	withMaxResults(t, 2)
+	var userID string
+	err := DB.QueryRow(`INSERT INTO users (username, emoji) VALUES ('synctest', '🔄') RETURNING user_id`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DB.Exec(`DELETE FROM users WHERE user_id = $1`, userID) })
+	_, err = DB.Exec(`INSERT INTO notes (user_id, data) VALUES ($1, 'a'), ($1, 'b'), ($1, 'c')`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, warnings := syncNotes(t, JSON{"userID": userID, "since": "1970-01-01T00:00:00Z"})
+	if len(first) != 2 {
+		t.Fatalf("first page: got %d notes, want 2", len(first))
+	}
+	if first[0].UpdatedAt != first[1].UpdatedAt {
+		t.Fatalf("want notes that tie, got %s and %s", first[0].UpdatedAt, first[1].UpdatedAt)
+	}
+	if !reflect.DeepEqual(warnings, []string{"notesModifiedSince: truncated to 2 results"}) {
+		t.Errorf("first page: got warnings %v", warnings)
+	}
+
+	last := first[len(first)-1]
+	rest, warnings := syncNotes(t, JSON{"userID": userID, "since": last.UpdatedAt, "afterNoteID": last.NoteID})
+	if len(rest) != 1 || rest[0].UpdatedAt != last.UpdatedAt {
+		t.Fatalf("second page: got %v, want the third note that ties", rest)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("second page: got warnings %v", warnings)
+	}
+
+	// An update moves the note past the cursor:
+	_, err = DB.Exec(`UPDATE notes SET data = 'a2' WHERE note_id = $1`, first[0].NoteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, _ := syncNotes(t, JSON{"userID": userID, "since": rest[0].UpdatedAt, "afterNoteID": rest[0].NoteID})
+	if len(changed) != 1 || changed[0].NoteID != first[0].NoteID || changed[0].Data != "a2" {
+		t.Errorf("after update: got %v, want only the updated note", changed)
+	}
+}
@@ -0,0 +1,119 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// Every note’s tags should come from one query, however many
+// notes there are — more than MaxParallelism resolvers’ worth:
+func TestTagsLoadedInOneQuery(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	var userID string
+	err := DB.QueryRow(`INSERT INTO users (username, emoji) VALUES ('tagtest', '🏷') RETURNING user_id`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DB.Exec(`DELETE FROM users WHERE user_id = $1`, userID) })
+	for i := 0; i < 25; i++ {
+		_, err := DB.Exec(`
+			WITH note AS (INSERT INTO notes (user_id, data) VALUES ($1, $2) RETURNING note_id)
+			INSERT INTO note_tags (note_id, tag) SELECT note_id, 'tag' FROM note
+		`, userID, fmt.Sprintf("Note %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, stats := withStats(withTagLoader(withMemo(context.Background())))
+	resp := Schema.Exec(ctx, `query($userID: ID!) { notes(userID: $userID, limit: 25) { tags } }`, "", map[string]interface{}{"userID": userID})
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	// One query for the notes, one for their tags:
+	if got := stats.JSON()["dbQueries"]; got != 2 {
+		t.Errorf("got %v queries, want 2", got)
+	}
+}
+
+// notesWithTags runs notesWithTags and returns the notes’ data
+// and any warnings:
+func notesWithTags(t *testing.T, userID string, tags []string, matchAll bool) ([]string, []string) {
+	t.Helper()
+	resp := Exec(context.Background(), ClientQuery{
+		Query: `query($userID: ID!, $tags: [String!]!, $matchAll: Boolean!) {
+			notesWithTags(userID: $userID, tags: $tags, matchAll: $matchAll) { data }
+		}`,
+		Variables: JSON{"userID": userID, "tags": tags, "matchAll": matchAll},
+	})
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	var data struct{ NotesWithTags []struct{ Data string } }
+	err := json.Unmarshal(resp.Data, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notes []string
+	for _, note := range data.NotesWithTags {
+		notes = append(notes, note.Data)
+	}
+	warnings, _ := resp.Extensions["warnings"].([]string)
+	return notes, warnings
+}
+
+func TestNotesWithTags(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	var userID string
+	err := DB.QueryRow(`INSERT INTO users (username, emoji) VALUES ('matchtest', '🇵🇹') RETURNING user_id`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DB.Exec(`DELETE FROM users WHERE user_id = $1`, userID) })
+	for data, tags := range map[string][]string{
+		"a": {"red", "blue"},
+		"b": {"red"},
+		"c": {"blue"},
+	} {
+		var noteID string
+		err := DB.QueryRow(`INSERT INTO notes (user_id, data) VALUES ($1, $2) RETURNING note_id`, userID, data).Scan(&noteID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range tags {
+			_, err := DB.Exec(`INSERT INTO note_tags (note_id, tag) VALUES ($1, $2)`, noteID, tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Arguments are lowercased and deduped, so "Red" and "red"
+	// count as one tag:
+	matched, warnings := notesWithTags(t, userID, []string{"Red", "blue"}, false)
+	if len(matched) != 3 || len(warnings) != 0 {
+		t.Errorf("any: got %v and warnings %v, want all 3 notes", matched, warnings)
+	}
+	all, _ := notesWithTags(t, userID, []string{"Red", "red", "BLUE"}, true)
+	if !reflect.DeepEqual(all, []string{"a"}) {
+		t.Errorf("all: got %v, want [a]", all)
+	}
+
+	// Over MaxResults, the list is truncated with a warning
+	// rather than silently:
+	withMaxResults(t, 2)
+	matched, warnings = notesWithTags(t, userID, []string{"red", "blue"}, false)
+	if len(matched) != 2 {
+		t.Errorf("capped: got %d notes, want 2", len(matched))
+	}
+	if !reflect.DeepEqual(warnings, []string{"notesWithTags: truncated to 2 results"}) {
+		t.Errorf("capped: got warnings %v", warnings)
+	}
+}
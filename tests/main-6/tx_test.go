@@ -0,0 +1,51 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// mockDB returns a sqlmock database, which fails the test if
+// its expectations weren’t met:
+func mockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		err := mock.ExpectationsWereMet()
+		if err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return db, mock
+}
+
+// A panic in fn is an error, and the transaction rolls back
+// rather than committing what fn wrote before it panicked:
+func TestRunInTxPanic(t *testing.T) {
+	db, mock := mockDB(t)
+	DB = db
+	t.Cleanup(func() { DB = nil })
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO notes").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+	err := runInTx(context.Background(), false, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO notes (user_id, data) VALUES ('u-1', 'half done')`)
+		if err != nil {
+			return err
+		}
+		panic("boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), "panic: boom") {
+		t.Errorf("got %v, want the panic as an error", err)
+	}
+}
@@ -0,0 +1,82 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// execData runs query and decodes its data into v:
+func execData(t *testing.T, query string, vars map[string]interface{}, v interface{}) {
+	t.Helper()
+	resp := Schema.Exec(context.Background(), query, "", vars)
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	err := json.Unmarshal(resp.Data, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateNoteIfVersion(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	var userID string
+	err := DB.QueryRow(`SELECT user_id FROM users LIMIT 1`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created struct {
+		CreateNote struct {
+			NoteID  string
+			Version int32
+		}
+	}
+	execData(t, `mutation($userID: ID!) { createNote(userID: $userID, note: {data: "v1"}) { noteID version } }`,
+		map[string]interface{}{"userID": userID}, &created)
+	noteID := created.CreateNote.NoteID
+	t.Cleanup(func() { DB.Exec(`DELETE FROM notes WHERE note_id = $1`, noteID) })
+	if created.CreateNote.Version != 1 {
+		t.Fatalf("got version %d, want 1", created.CreateNote.Version)
+	}
+
+	update := `mutation($noteID: ID!, $data: String!, $version: Int!) {
+		updateNoteIfVersion(noteID: $noteID, data: $data, expectedVersion: $version) { version }
+	}`
+	var updated struct{ UpdateNoteIfVersion struct{ Version int32 } }
+	execData(t, update, map[string]interface{}{"noteID": noteID, "data": "v2", "version": 1}, &updated)
+	if updated.UpdateNoteIfVersion.Version != 2 {
+		t.Errorf("got version %d, want 2", updated.UpdateNoteIfVersion.Version)
+	}
+	execAndExpectError(t, Schema, update, map[string]interface{}{"noteID": noteID, "data": "v3", "version": 1},
+		[]interface{}{"updateNoteIfVersion"}, "stale version: note is at version 2, not 1")
+
+	// Any update bumps the version, not just updateNoteIfVersion:
+	var pinned struct{ PinNote struct{ Version int32 } }
+	execData(t, `mutation($noteID: ID!) { pinNote(noteID: $noteID, pinned: true) { version } }`,
+		map[string]interface{}{"noteID": noteID}, &pinned)
+	if pinned.PinNote.Version != 3 {
+		t.Errorf("pinned: got version %d, want 3", pinned.PinNote.Version)
+	}
+}
+
+// A dry run’s note was never committed, but it still has a
+// version:
+func TestDryRunNoteVersion(t *testing.T) {
+	testDB(t)
+	testSchema(t)
+	var userID string
+	err := DB.QueryRow(`SELECT user_id FROM users LIMIT 1`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created struct{ CreateNote struct{ Version int32 } }
+	execData(t, `mutation($userID: ID!) { createNote(userID: $userID, note: {data: "dry"}, dryRun: true) { version } }`,
+		map[string]interface{}{"userID": userID}, &created)
+	if created.CreateNote.Version != 1 {
+		t.Errorf("got version %d, want 1", created.CreateNote.Version)
+	}
+}
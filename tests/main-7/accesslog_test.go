@@ -0,0 +1,39 @@
+//go:build example
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	handler := withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}), &out)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/graphql?query={greet}", nil))
+	line := out.String()
+	if !strings.HasPrefix(line, "192.0.2.1 - - [") || strings.Count(line, "\n") != 1 {
+		t.Fatalf("got %q, want one line for 192.0.2.1", line)
+	}
+	if want := `"GET /graphql?query={greet} HTTP/1.1" 418 15 `; !strings.Contains(line, want) {
+		t.Errorf("got %q, want it to contain %q", line, want)
+	}
+}
+
+// A handler that only writes gets an implicit 200:
+func TestAccessLogImplicitStatus(t *testing.T) {
+	var out bytes.Buffer
+	handler := withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), &out)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/graphql", nil))
+	if want := `"POST /graphql HTTP/1.1" 200 2 `; !strings.Contains(out.String(), want) {
+		t.Errorf("got %q, want it to contain %q", out.String(), want)
+	}
+}
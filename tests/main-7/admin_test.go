@@ -0,0 +1,28 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// allNotes is only in the admin schema, so /graphql rejects it
+// before any resolver runs:
+func TestAdminSchema(t *testing.T) {
+	query := `{ allNotes { noteID userID } }`
+	resp := Schemas["/admin/graphql"].Exec(context.Background(), query, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Errorf("/admin/graphql: %v", resp.Errors)
+	}
+	resp = Schemas["/graphql"].Exec(context.Background(), query, "", nil)
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, `Cannot query field "allNotes"`) {
+		t.Errorf("/graphql: got %v, want allNotes to be unknown", resp.Errors)
+	}
+	// Not even introspection shows it:
+	resp = Schemas["/graphql"].Exec(context.Background(), `{ __type(name: "Query") { fields { name } } }`, "", nil)
+	if strings.Contains(string(resp.Data), "allNotes") {
+		t.Errorf("/graphql introspection: got %s", resp.Data)
+	}
+}
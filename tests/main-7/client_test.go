@@ -0,0 +1,62 @@
+//go:build example
+
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func greetServer() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := Schema.Exec(r.Context(), r.URL.Query().Get("query"), "", nil)
+		w.Write(resp.Data)
+	})
+}
+
+func TestRunClient(t *testing.T) {
+	srv := httptest.NewServer(greetServer())
+	defer srv.Close()
+	bstr, err := runClient(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bstr), "Hello, world!") {
+		t.Errorf("got %s", bstr)
+	}
+}
+
+// The TLS server’s certificate is self-signed, so the client
+// only trusts it given the certificate (see clientFor):
+func TestRunClientTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(greetServer())
+	defer srv.Close()
+
+	_, err := runClient(http.DefaultClient, srv.URL)
+	if err == nil {
+		t.Error("the default client trusted a self-signed certificate")
+	}
+
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	bstr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	err = os.WriteFile(certFile, bstr, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := clientFor(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bstr, err = runClient(client, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bstr), "Hello, world!") {
+		t.Errorf("got %s", bstr)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCostCharged(t *testing.T) {
+	budgets = &costBudgets{spent: map[string]int{}}
+	ctx, meter := withCost(context.Background(), "ip:test")
+	defer meter.cancel()
+	resp := Schema.Exec(ctx, `{ greet version }`, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	if meter.Cost() != 2 || meter.Exceeded() {
+		t.Errorf("got cost %d, exceeded %v; want 2, false", meter.Cost(), meter.Exceeded())
+	}
+	if got := budgets.remaining("ip:test"); got != CostBudget-2 {
+		t.Errorf("got remaining %d, want %d", got, CostBudget-2)
+	}
+}
+
+func TestCostRefusedOverBudget(t *testing.T) {
+	budgets = &costBudgets{spent: map[string]int{}}
+	budgets.charge("ip:test", CostBudget-1)
+	ctx, meter := withCost(context.Background(), "ip:test")
+	defer meter.cancel()
+	// users is one field, but each user’s fields cost one
+	// more each:
+	Schema.Exec(ctx, `{ users { username } }`, "", nil)
+	if !meter.Exceeded() {
+		t.Error("want the query refused")
+	}
+	if got := budgets.remaining("ip:test"); got != 0 {
+		t.Errorf("got remaining %d, want 0", got)
+	}
+}
+
+func TestCostClientIgnoresUserID(t *testing.T) {
+	a := httptest.NewRequest("GET", "/graphql", nil)
+	a.Header.Set("X-User-ID", "u-001")
+	b := httptest.NewRequest("GET", "/graphql", nil)
+	b.Header.Set("X-User-ID", "u-002")
+	if costClient(a) != costClient(b) {
+		t.Error("changing X-User-ID changed the budget")
+	}
+}
@@ -0,0 +1,90 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const createNoteBody = `{
+	"operationName": "CreateNote",
+	"query": "mutation CreateNote($userID: ID!, $note: NoteInput!) { createNote(userID: $userID, note: $note) { data } }",
+	"variables": {"userID": "u-001", "note": {"data": "Hello, nested!"}},
+	"extensions": {"persistedQuery": {"version": 1}}
+}`
+
+func parseBody(t testing.TB, body string) (ClientQuery, error) {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return parseClientQuery(httptest.NewRecorder(), r)
+}
+
+func TestParseClientQueryNestedVariables(t *testing.T) {
+	q, err := parseBody(t, createNoteBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := Schema.Exec(context.Background(), q.Query, q.OpName, q.Variables)
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	if got := string(resp.Data); !strings.Contains(got, "Hello, nested!") {
+		t.Errorf("got %s, want the note’s data", got)
+	}
+}
+
+func TestParseClientQueryUnknownField(t *testing.T) {
+	_, err := parseBody(t, `{"query": "{ greet }", "variable": {}}`)
+	if err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Errorf("got %v, want an unknown field error", err)
+	}
+}
+
+// Bad bodies get a fixed message, not the decoder’s error,
+// which can quote the body back:
+func TestQueryErrorMessage(t *testing.T) {
+	for body, want := range map[string]string{
+		``:                                  "request body is empty",
+		`{"query": "{ greet }"`:             "request body is not valid JSON",
+		`{"query": <script>}`:               "request body is not valid JSON",
+		`{"query": 1}`:                      "query: expected string",
+		`{"query": "{ greet }", "<b>": {}}`: "request body has an unknown field; expected query, operationName, variables, or extensions",
+	} {
+		_, err := parseBody(t, body)
+		if err == nil {
+			t.Errorf("%s: got no error", body)
+			continue
+		}
+		if got := queryErrorMessage(err); got != want {
+			t.Errorf("%s: got %q, want %q", body, got, want)
+		}
+	}
+}
+
+// Compares the cost of parseClientQuery’s strict decoding with
+// a plain decode of the same body. Both decode from a reader,
+// so the only difference is DisallowUnknownFields:
+//
+// $ go test -tags example -bench Decode
+
+func benchmarkDecode(b *testing.B, strict bool) {
+	for i := 0; i < b.N; i++ {
+		var q ClientQuery
+		decoder := json.NewDecoder(strings.NewReader(createNoteBody))
+		if strict {
+			decoder.DisallowUnknownFields()
+		}
+		err := decoder.Decode(&q)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeStrict(b *testing.B)  { benchmarkDecode(b, true) }
+func BenchmarkDecodeLenient(b *testing.B) { benchmarkDecode(b, false) }
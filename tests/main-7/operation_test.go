@@ -0,0 +1,37 @@
+//go:build example
+
+package main
+
+import "testing"
+
+func TestOperationType(t *testing.T) {
+	tests := []struct {
+		document string
+		opName   string
+		want     string
+	}{
+		{`{ greet }`, "", "query"},
+		{`query { greet }`, "", "query"},
+		{`  mutation { createNote(data: "hi") { noteID } }`, "", "mutation"},
+		{`# mutation
+		{ greet }`, "", "query"},
+		{`{ greet(name: "mutation { x }") }`, "", "query"},
+		{`fragment F on Note { noteID } mutation M { createNote(data: "hi") { ...F } }`, "", "mutation"},
+		{`query Q { greet } mutation M { createNote(data: "hi") { noteID } }`, "M", "mutation"},
+		{`query Q { greet } mutation M { createNote(data: "hi") { noteID } }`, "Q", "query"},
+		{`query Q($f: NoteFilter = {status: DRAFT}) @live { greet }`, "", "query"},
+		{`subscription { noteCreated { noteID } }`, "", "subscription"},
+	}
+	for _, test := range tests {
+		got, err := operationType(test.document, test.opName)
+		if err != nil || got != test.want {
+			t.Errorf("operationType(%q, %q) = %q, %v; want %q", test.document, test.opName, got, err, test.want)
+		}
+	}
+	for _, document := range []string{`query Q { greet } mutation M { greet }`, ``} {
+		_, err := operationType(document, "")
+		if err == nil {
+			t.Errorf("operationType(%q, \"\"): want an error", document)
+		}
+	}
+}
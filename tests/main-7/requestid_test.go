@@ -0,0 +1,62 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r.Context())
+	}))
+	generated := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	for header, echoed := range map[string]bool{
+		"abc-123_DEF.4":         true,
+		strings.Repeat("a", 64): true,
+		"":                      false,
+		strings.Repeat("a", 65): false,
+		"forged\n[other] line":  false,
+		"a b":                   false,
+		"<script>":              false,
+		"café":                  false,
+	} {
+		r := httptest.NewRequest("GET", "/graphql", nil)
+		if header != "" {
+			r.Header.Set("X-Request-ID", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		got := w.Header().Get("X-Request-ID")
+		if got != seen {
+			t.Errorf("%q: header %q differs from context %q", header, got, seen)
+		}
+		if echoed && got != header {
+			t.Errorf("%q: got %q, want it echoed", header, got)
+		}
+		if !echoed && !generated.MatchString(got) {
+			t.Errorf("%q: got %q, want a generated ID", header, got)
+		}
+	}
+}
+
+// GraphQL errors carry the request ID, like negotiated errors:
+func TestRequestIDInErrors(t *testing.T) {
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc-123")
+	resp, _ := execOperation(ctx, Schema, ClientQuery{Query: `{ nope }`}, time.Second)
+	if len(resp.Errors) == 0 {
+		t.Fatal("want an error")
+	}
+	for _, err := range resp.Errors {
+		if err.Extensions["requestID"] != "abc-123" {
+			t.Errorf("got extensions %v, want the request ID", err.Extensions)
+		}
+	}
+}
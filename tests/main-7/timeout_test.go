@@ -0,0 +1,46 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// slowResolver takes a second and, like most resolvers here,
+// ignores its context:
+type slowResolver struct{}
+
+func (*slowResolver) Slow() string {
+	time.Sleep(time.Second)
+	return "done"
+}
+
+func TestExecOperationTimesOut(t *testing.T) {
+	schema := graphql.MustParseSchema(`
+		schema { query: Query }
+		type Query { slow: String! }
+	`, &slowResolver{})
+	start := time.Now()
+	resp, timedOut := execOperation(context.Background(), schema, ClientQuery{Query: `{ slow }`}, 10*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %s; want it to give up after 10ms", elapsed)
+	}
+	if !timedOut {
+		t.Fatal("want timedOut")
+	}
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "operation timed out") {
+		t.Errorf("got errors %v, want operation timed out", resp.Errors)
+	}
+}
+
+func TestExecOperationInTime(t *testing.T) {
+	resp, timedOut := execOperation(context.Background(), Schema, ClientQuery{Query: `{ greet }`}, time.Second)
+	if timedOut || len(resp.Errors) > 0 {
+		t.Errorf("got timedOut %v, errors %v", timedOut, resp.Errors)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build example
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// Analysis: both styles resolve fields through reflection,
+// so the difference is small. Field resolvers read struct
+// fields directly, whereas method resolvers call a method
+// and allocate a resolver per user and per note (see
+// UserResolver.Notes). Expect method resolvers to allocate
+// a little more per op; in exchange, they let us compute
+// fields, delegate to other resolvers, and return errors.
+// Prefer whichever reads better — the overhead is dwarfed
+// by a single database round trip (see main-6).
+//
+// Example output (varies by machine):
+//
+// BenchmarkFieldResolvers-8     16652     72509 ns/op   22401 B/op   382 allocs/op
+// BenchmarkMethodResolvers-8    14607     78120 ns/op   23625 B/op   461 allocs/op
+
+// The benchmarks only compare like with like if both schemas
+// give the same answer:
+func TestResolversAgree(t *testing.T) {
+	field, method := exec(FieldSchema), exec(MethodSchema)
+	if !bytes.Equal(field, method) {
+		t.Errorf("field resolvers: %s\nmethod resolvers: %s", field, method)
+	}
+}
+
+func benchmarkExec(b *testing.B, schema *graphql.Schema) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resp := schema.Exec(context.Background(), query, "", nil)
+		if len(resp.Errors) > 0 {
+			b.Fatal(resp.Errors)
+		}
+	}
+}
+
+func BenchmarkFieldResolvers(b *testing.B) {
+	benchmarkExec(b, FieldSchema)
+}
+
+func BenchmarkMethodResolvers(b *testing.B) {
+	benchmarkExec(b, MethodSchema)
+}
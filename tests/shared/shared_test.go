@@ -0,0 +1,65 @@
+//go:build example
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// execAndExpectError runs query and checks that it fails with
+// exactly one error, at wantPath, whose message contains
+// wantMessageSubstr, e.g.:
+//
+//	execAndExpectError(t, schema, `{ user(userID: "x") { username } }`, nil,
+//		[]interface{}{"user"}, "user not found")
+func execAndExpectError(t *testing.T, schema *graphql.Schema, query string, vars map[string]interface{}, wantPath []interface{}, wantMessageSubstr string) {
+	t.Helper()
+	resp := schema.Exec(context.Background(), query, "", vars)
+	if len(resp.Errors) != 1 {
+		t.Fatalf("got %d errors, want 1: %v", len(resp.Errors), resp.Errors)
+	}
+	err := resp.Errors[0]
+	if !reflect.DeepEqual(err.Path, wantPath) {
+		t.Errorf("got path %v, want %v", err.Path, wantPath)
+	}
+	if !strings.Contains(err.Message, wantMessageSubstr) {
+		t.Errorf("got message %q, want it to contain %q", err.Message, wantMessageSubstr)
+	}
+}
+
+// fieldDescriptions returns the descriptions of typeName’s
+// fields, by name, as introspection reports them:
+func fieldDescriptions(t *testing.T, schema *graphql.Schema, typeName string) map[string]string {
+	t.Helper()
+	resp := schema.Exec(context.Background(), `query($name: String!) {
+		__type(name: $name) { fields { name description } }
+	}`, "", map[string]interface{}{"name": typeName})
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	var data struct {
+		Type struct {
+			Fields []struct {
+				Name        string
+				Description *string
+			}
+		} `json:"__type"`
+	}
+	err := json.Unmarshal(resp.Data, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptions := map[string]string{}
+	for _, field := range data.Type.Fields {
+		if field.Description != nil {
+			descriptions[field.Name] = *field.Description
+		}
+	}
+	return descriptions
+}